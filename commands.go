@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/e-minguez/file-to-machineconfig/pkg/converter"
+)
+
+// command A subcommand, the default (no command) converts files to a MachineConfig
+type command struct {
+	usage string
+	run   func(args []string)
+}
+
+var commands = map[string]command{
+	"diff": {
+		usage: diffUsage,
+		run:   diff,
+	},
+	"extract": {
+		usage: extractUsage,
+		run:   extract,
+	},
+	"lint-dir": {
+		usage: lintDirUsage,
+		run:   lintDir,
+	},
+	"render": {
+		usage: renderUsage,
+		run:   render,
+	},
+	"verify-hash": {
+		usage: verifyHashUsage,
+		run:   verifyHash,
+	},
+}
+
+// commandNames Returns the subcommand names sorted
+func commandNames() []string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runCommand Runs the subcommand named in the first argument, if any
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+	cmd.run(args[1:])
+	return true
+}
+
+// newFlagSet Creates the flags of a subcommand
+func newFlagSet(name string, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Printf("Usage: %s %s\n", os.Args[0], usage)
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	return fs
+}
+
+const verifyHashUsage = "verify-hash machineconfig.yaml [machineconfig.yaml...]"
+
+// verifyHash Checks the payload of every file against its recorded hash
+func verifyHash(args []string) {
+	fs := newFlagSet("verify-hash", verifyHashUsage)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+	}
+
+	failed := 0
+	for _, file := range fs.Args() {
+		mc := converter.LoadMachineConfig(file)
+		for _, result := range converter.VerifyHashes(mc) {
+			if result.Err != nil {
+				failed++
+				fmt.Printf("%s: %s: FAILED (%s)\n", mc.Name, result.Path, result.Err)
+				if result.Actual != "" {
+					fmt.Printf("  expected %s\n  got      %s\n", result.Expected, result.Actual)
+				}
+				continue
+			}
+			if result.Skipped {
+				fmt.Printf("%s: %s: SKIPPED (remote source)\n", mc.Name, result.Path)
+				continue
+			}
+			fmt.Printf("%s: %s: OK\n", mc.Name, result.Path)
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d file(s) failed the verification", failed)
+	}
+}
+
+const extractUsage = "extract [--output-dir dir] machineconfig.yaml"
+
+// extract Writes the files of a MachineConfig to a local directory and reports its content
+func extract(args []string) {
+	fs := newFlagSet("extract", extractUsage)
+	dir := fs.String("output-dir", "", "The directory the files are written to (the MachineConfig name by default)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+
+	mc := converter.LoadMachineConfig(fs.Arg(0))
+	if *dir == "" {
+		*dir = mc.Name
+	}
+	fmt.Printf("%s: extracting to %s\n", mc.Name, *dir)
+	converter.ExtractMachineConfig(mc, *dir, os.Stdout)
+}
+
+const diffUsage = "diff a.yaml b.yaml"
+
+// diff Compares two MachineConfigs, exits with 1 if they differ (as diff does)
+func diff(args []string) {
+	fs := newFlagSet("diff", diffUsage)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+	}
+
+	a := converter.LoadMachineConfig(fs.Arg(0))
+	b := converter.LoadMachineConfig(fs.Arg(1))
+	if converter.DiffMachineConfigs(a, b, os.Stdout) {
+		os.Exit(1)
+	}
+}
+
+const renderUsage = "render [--pool worker] dir"
+
+// render Prints the config the MCO would render for a pool from the MachineConfigs in a directory
+func render(args []string) {
+	fs := newFlagSet("render", renderUsage)
+	pool := fs.String("pool", "worker", "The pool to render, its MachineConfigPool in the directory provides the selector if there is one")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+
+	mcs, pools := converter.LoadDirectory(fs.Arg(0))
+	rendered := converter.RenderPool(*pool, mcs, pools)
+	converter.ValidateMachineConfig(rendered.MachineConfig)
+	fmt.Print(converter.RenderedPoolOutput(rendered))
+}
+
+const lintDirUsage = "lint-dir dir"
+
+// lintDir Reports the nodes written by more than one MachineConfig of a pool, fails if their contents differ
+func lintDir(args []string) {
+	fs := newFlagSet("lint-dir", lintDirUsage)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+
+	mcs, pools := converter.LoadDirectory(fs.Arg(0))
+	conflicts := 0
+	for _, issue := range converter.LintDirectory(mcs, pools) {
+		fmt.Println(issue)
+		if len(issue.Differences) > 0 {
+			conflicts++
+		}
+	}
+	if conflicts > 0 {
+		log.Fatalf("%d override(s) writing something different", conflicts)
+	}
+}
@@ -4,59 +4,104 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"runtime"
 
 	"github.com/e-minguez/file-to-machineconfig/pkg/converter"
 )
 
 func printUsage() {
 	fmt.Printf("Usage: %s --file /local/path/to/my/file.txt [options]\n", os.Args[0])
+	fmt.Printf("       %s --manifest spec.yaml [options]\n", os.Args[0])
+	for _, name := range commandNames() {
+		fmt.Printf("       %s %s\n", os.Args[0], commands[name].usage)
+	}
 	fmt.Println("Options:")
 	flag.PrintDefaults()
-	fmt.Printf("Example:\n%s --file /local/path/to/my/file.txt --remote /path/to/remote/file.txt --plain --label \"machineconfiguration.openshift.io/role: master\",\"example.com/foo: bar\"\n", os.Args[0])
+	fmt.Printf("Example:\n%s --file /local/path/to/my/file.txt --remote /path/to/remote/file.txt --encoding plain --labels \"machineconfiguration.openshift.io/role: master\",\"example.com/foo: bar\"\n", os.Args[0])
+	fmt.Printf("%s --file ./chrony.conf:/etc/chrony.conf:0644 --file ./foo.d:/etc/foo.d::root:root\n", os.Args[0])
 	os.Exit(1)
 }
 
 func main() {
 
+	// Subcommands work with existing MachineConfigs
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	data := converter.Parameters{}
 
 	// https://coreos.com/ignition/docs/latest/configuration-v2_2.html
-	flag.StringVar(&data.LocalPath, "file", "", "The path to the local file [Required]")
-	flag.StringVar(&data.RemotePath, "remote", "", "The absolute path to the remote file [Required if running on Windows]")
+	flag.Var(&data.Files, "file", "The path to the local file or directory as local[:remote[:mode[:user[:group]]]], can be repeated [Required]")
+	flag.StringVar(&data.Manifest, "manifest", "", "YAML/JSON manifest describing the whole MachineConfig, flags override its values")
+	flag.StringVar(&data.Into, "into", "", "Existing MachineConfig (YAML/JSON) the files are added to, replacing the ones with the same path")
+	flag.StringVar(&data.RemotePath, "remote", "", "The absolute path to the remote file when a single file is used [Required if running on Windows]")
+	flag.Var(&data.UnitFiles, "unit", "The path to a local systemd unit file, can be repeated")
+	flag.Var(&data.Dropins, "dropin", "A systemd dropin as unit:/local/path/to/dropin.conf, can be repeated")
+	flag.Var(&data.Enable, "enable", "The name of a systemd unit to enable, can be repeated")
+	flag.Var(&data.Disable, "disable", "The name of a systemd unit to disable, can be repeated")
+	flag.Var(&data.Mask, "mask", "The name of a systemd unit to mask, can be repeated")
 	flag.StringVar(&data.Name, "name", "", "MachineConfig object name [Required if running on Windows]")
 	flag.StringVar(&data.Labels, "labels", "", "MachineConfig metadata labels (separted by ,)")
+	flag.StringVar(&data.Roles, "roles", "", "Roles (separated by ,) to generate a MachineConfig for each, with its role label and a role specific name")
+	flag.BoolVar(&data.CreatePool, "create-pool", false, "Create the MachineConfigPool of custom roles, selecting the worker and role MachineConfigs (false by default)")
+	flag.StringVar(&data.MaxUnavailable, "max-unavailable", "", "Number or percentage of nodes of the created pool updated at a time (1 by default)")
+	flag.BoolVar(&data.Paused, "paused", false, "Create the pool paused (false by default)")
 	flag.StringVar(&data.User, "user", "", "The user name of the owner")
 	flag.StringVar(&data.Group, "group", "", "The group name of the owner")
+	flag.StringVar(&data.UID, "uid", "", "The user id of the owner, instead of --user")
+	flag.StringVar(&data.GID, "gid", "", "The group id of the owner, instead of --group")
+	flag.StringVar(&data.OwnerMap, "owner-map", "", "YAML/JSON file translating the owners of local files to node owners (users: {local: node}, groups: {local: node})")
+	flag.BoolVar(&data.NumericIDs, "numeric-ids", false, "Use the uid/gid of local files whose owners can't be resolved to names (false by default)")
+	flag.Var(&data.CreateUsers, "create-user", "A user to be created as name[:uid[:home[:shell[:group,group...]]]], can be repeated")
+	flag.Var(&data.CreateGroups, "create-group", "A group to be created as name[:gid], can be repeated")
+	flag.BoolVar(&data.CreateOwners, "create-owners", false, "Create the users and groups owning the files that are not RHCOS system accounts (false by default)")
+	flag.Var(&data.SSHKeysFiles, "ssh-keys-file", "An authorized_keys file whose keys are added to --ssh-user, can be repeated")
+	flag.StringVar(&data.SSHUser, "ssh-user", "", "The user the ssh keys are added to ('core' by default)")
 	flag.StringVar(&data.Filesystem, "filesystem", "", "The internal identifier of the filesystem in which to write the file")
 	flag.StringVar(&data.APIVer, "apiversion", "", "MachineConfig API version")
 	flag.StringVar(&data.IgnitionVer, "ignitionversion", "", "Ignition version")
+	flag.StringVar(&data.Content, "encoding", "", "Encoding of the file contents: base64 (default), plain (percent encoded text) or auto to use plain for text files")
+	flag.StringVar(&data.Compress, "compress", "", "Compress the file contents: gzip, or auto to compress only when the result is smaller")
+	flag.StringVar(&data.SourceURL, "source-url", "", "URL (https, http, s3 or tftp) the node downloads the file from instead of embedding it, the local file provides its hash. Only with a single file")
+	flag.Var(&data.CAs, "ca", "CA certificate trusted for https sources, as a URL or a local PEM file, can be repeated")
+	flag.IntVar(&data.HTTPResponseHeaders, "http-response-headers-timeout", 0, "Seconds to wait for the HTTP response headers of remote sources")
+	flag.IntVar(&data.HTTPTotal, "http-total-timeout", 0, "Seconds to wait for remote sources to be downloaded")
 	flag.IntVar(&data.Mode, "mode", 0, "File's permission mode in octal")
 	flag.BoolVar(&data.Yaml, "yaml", false, "Use yaml output instead JSON (false by default)")
+	flag.StringVar(&data.OutputKind, "output-kind", "", "What to print: machineconfig (default), or ignition for the bare ignition config (JSON)")
+	flag.StringVar(&data.OutputDir, "output-dir", "", "Write every object as YAML to this directory (e.g. the openshift-install manifests) instead of printing it")
 
 	flag.Parse()
+	data.SetFlags = make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { data.SetFlags[f.Name] = true })
 
 	// if user does not supply flags, print usage
-	if flag.NFlag() == 0 || data.LocalPath == "" {
-		printUsage()
-	}
-
-	if runtime.GOOS == "windows" && (data.LocalPath == "" || data.RemotePath == "" || data.Name == "") {
+	if flag.NFlag() == 0 {
 		printUsage()
 	}
 
 	// Some sanity checks/normalization
 	converter.CheckParameters(&data)
 
-	// Fill the machine-config struct
-	mc := converter.NewMachineConfig(data)
+	// Fill the machine-config structs, one per role, and the pools of custom roles
+	mcs := converter.NewMachineConfigs(data)
+	pools := converter.NewMachineConfigPools(data)
+
+	// Fail before printing anything the node would reject
+	for _, mc := range mcs {
+		converter.ValidateMachineConfig(mc)
+	}
 
-	// Convert and print the machine-config struct to json or yaml
+	// Convert and print the machine-config structs to json or yaml, or just the ignition config
 	switch {
+	case data.OutputDir != "":
+		converter.WriteObjects(mcs, pools, data.OutputDir)
+	case data.OutputKind == "ignition":
+		fmt.Println(converter.IgnitionOutput(mcs[0]))
 	case data.Yaml == true:
-		fmt.Println(converter.MachineConfigOutput(mc, "yaml"))
+		fmt.Println(converter.ObjectsOutput(mcs, pools, "yaml"))
 	default:
-		fmt.Println(converter.MachineConfigOutput(mc, "json"))
+		fmt.Println(converter.ObjectsOutput(mcs, pools, "json"))
 	}
 
 }
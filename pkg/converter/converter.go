@@ -1,56 +1,274 @@
 package converter
 
 import (
-	b64 "encoding/base64"
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"io/ioutil"
 	"log"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/ghodss/yaml"
+	"github.com/vincent-petithory/dataurl"
 
 	igntypes "github.com/coreos/ignition/config/v2_2/types"
 	MachineConfig "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 )
 
 // Parameters Struct containing all the parameters required
 type Parameters struct {
-	LocalPath   string
-	RemotePath  string
-	Name        string
-	Labels      string
-	User        string
-	Group       string
-	Filesystem  string
-	APIVer      string
-	IgnitionVer string
-	Content     string
-	Mode        int
-	Yaml        bool
+	Files                  MultiFlag
+	RemotePath             string
+	Name                   string
+	Labels                 string
+	Roles                  string
+	CreatePool             bool
+	MaxUnavailable         string
+	Paused                 bool
+	OutputKind             string
+	OutputDir              string
+	User                   string
+	Group                  string
+	UID                    string
+	GID                    string
+	OwnerMap               string
+	NumericIDs             bool
+	CreateUsers            MultiFlag
+	CreateGroups           MultiFlag
+	CreateOwners           bool
+	PasswdUsers            []igntypes.PasswdUser
+	PasswdGroups           []igntypes.PasswdGroup
+	SSHKeysFiles           MultiFlag
+	SSHUser                string
+	Into                   string
+	Filesystem             string
+	APIVer                 string
+	IgnitionVer            string
+	Content                string
+	Mode                   int
+	Yaml                   bool
+	Compress               string
+	SourceURL              string
+	CAs                    MultiFlag
+	HTTPResponseHeaders    int
+	HTTPTotal              int
+	CertificateAuthorities []igntypes.CaReference
+	Manifest               string
+	// Flags provided in the command line, they override the manifest even when false
+	SetFlags  map[string]bool
+	Entries   []Entry
+	UnitFiles MultiFlag
+	Dropins   MultiFlag
+	Enable    MultiFlag
+	Disable   MultiFlag
+	Mask      MultiFlag
+	Units     []igntypes.Unit
+}
+
+// MultiFlag Repeatable flag, every value is appended to the list
+type MultiFlag []string
+
+// String Returns the values separated by ,
+func (f *MultiFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set Appends a value to the list
+func (f *MultiFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Entry Struct containing the parameters of a single file, directory or link
+type Entry struct {
+	LocalPath  string
+	RemotePath string
+	User       string
+	Group      string
+	UID        *int
+	GID        *int
+	Mode       int
+	Directory  bool
+	Target     string
+	Hard       bool
+	Source     string
+
+	// Files with more than one hard link share it, see checkHardLinks
+	hardLinkID string
 }
 
 // Default values
 var defaultFilesystem = "root"
 var defaultIgnitionVersion = "2.2.0"
+
+// The config is always built as 2.2 and translated when printed
+var ignitionVersions = []string{"2.0.0", "2.1.0", "2.2.0", "3.0.0", "3.1.0", "3.2.0"}
 var defaultMachineConfigPrefix = "99-"
-var defaultLabel = "machineconfiguration.openshift.io/role: worker"
+var roleLabel = "machineconfiguration.openshift.io/role"
+var defaultLabel = roleLabel + ": worker"
 var defaultApiversion = "machineconfiguration.openshift.io/v1"
+var defaultOwner = "root"
+var defaultDirectoryMode = 0755
 
-// fileToBase64 Encode a file to base64
-func fileToBase64(file string) string {
+// Compression modes, auto only compresses when the result is smaller
+var compressionModes = []string{"gzip", "auto"}
+var compressionGzip = "gzip"
+
+// Objects printed, ignition prints the bare config the MachineConfig would contain
+var outputKinds = []string{"machineconfig", "ignition"}
+var defaultOutputKind = "machineconfig"
+var outputKindIgnition = "ignition"
+
+// Encodings of the data URLs, auto uses plain for text files
+var encodings = []string{"base64", "plain", "auto"}
+var defaultEncoding = "base64"
+
+// Media types of files the content sniffer reports as plain text or binary
+var extensionMediaTypes = map[string]string{
+	".pem":  "application/x-pem-file",
+	".crt":  "application/x-pem-file",
+	".cer":  "application/x-pem-file",
+	".key":  "application/x-pem-file",
+	".der":  "application/pkix-cert",
+	".json": "application/json",
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".xml":  "application/xml",
+	".sh":   "text/x-shellscript",
+	".py":   "text/x-python",
+	".tar":  "application/x-tar",
+}
+var defaultMediaType = "application/octet-stream"
+var gzipMediaType = "application/gzip"
+
+// Schemes the node can download remote contents from
+var sourceSchemes = []string{"https", "http", "s3", "tftp"}
+
+// readLocalFile Returns the content of a local file
+func readLocalFile(file string) []byte {
 	f, err := ioutil.ReadFile(file)
 	if err != nil {
 		log.Fatal(err)
 	}
-	encodedcontent := b64.StdEncoding.EncodeToString([]byte(f))
-	if encodedcontent == "" {
-		log.Fatal("The content of the file couldn't be encoded in base64")
+	return f
+}
+
+// isText Verify the content is human readable text
+func isText(content []byte) bool {
+	if !utf8.Valid(content) {
+		return false
+	}
+	for _, r := range string(content) {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// contentMediaType Returns the media type of the content, the extension of the file refines what the sniffer finds
+func contentMediaType(file string, content []byte) string {
+	mediatype, _, err := mime.ParseMediaType(http.DetectContentType(content))
+	if err != nil {
+		mediatype = defaultMediaType
+	}
+	hint, ok := extensionMediaTypes[strings.ToLower(filepath.Ext(file))]
+	if !ok {
+		return mediatype
+	}
+	// The hint is only trusted if it agrees with the content being text or binary
+	text := isText(content)
+	switch {
+	case mediatype == "text/plain" && text:
+		return hint
+	case mediatype == defaultMediaType && !text && !strings.HasPrefix(hint, "text/"):
+		return hint
 	}
-	return encodedcontent
+	return mediatype
+}
+
+// fileDataURL Creates the data URL of a file, base64 or percent encoded (RFC 2397).
+// The charset is only added for text.
+func fileDataURL(file string, content []byte, encoding string) string {
+	var du *dataurl.DataURL
+	if isText(content) {
+		du = dataurl.New(content, contentMediaType(file, content), "charset", "utf-8")
+	} else {
+		du = dataurl.New(content, contentMediaType(file, content))
+	}
+	if encoding == "plain" || (encoding == "auto" && isText(content)) {
+		du.Encoding = dataurl.EncodingASCII
+	}
+	return du.String()
+}
+
+// gzipContent Compress content with gzip
+func gzipContent(content []byte) []byte {
+	var b bytes.Buffer
+	w, err := gzip.NewWriterLevel(&b, gzip.BestCompression)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := w.Write(content); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// fileContents Creates the ignition contents of a local file, encoded and gzipped as requested
+func fileContents(entry Entry, compress string, encoding string) igntypes.FileContents {
+	content := readLocalFile(entry.LocalPath)
+
+	// The hash is always computed from the uncompressed content
+	sum, err := contentHash(defaultHashFunction, content)
+	if err != nil {
+		log.Fatal(err)
+	}
+	verification := igntypes.Verification{
+		Hash: &sum,
+	}
+
+	// The node downloads the content, the local copy only pins it
+	if entry.Source != "" {
+		return igntypes.FileContents{
+			Source:       entry.Source,
+			Verification: verification,
+		}
+	}
+
+	contents := igntypes.FileContents{
+		Source:       fileDataURL(entry.LocalPath, content, encoding),
+		Verification: verification,
+	}
+	if compress == "" {
+		return contents
+	}
+
+	// The data URL holds the compressed payload, ignition decompresses it when writing the file
+	compressed := igntypes.FileContents{
+		Compression:  compressionGzip,
+		Source:       dataurl.New(gzipContent(content), gzipMediaType).String(),
+		Verification: verification,
+	}
+	if compress == compressionGzip || len(compressed.Source)+len(compressed.Compression) < len(contents.Source) {
+		return compressed
+	}
+	return contents
 }
 
 // labelsToMap Creates a string map with the labels the user provides
@@ -69,48 +287,124 @@ func labelsToMap(labels string) map[string]string {
 
 // CheckParameters Normalize parameters
 func CheckParameters(rawdata *Parameters) {
-	// Check for errors first
-
-	// Verify file exists
-	file, err := os.Stat(rawdata.LocalPath)
-	if os.IsNotExist(err) {
-		log.Fatalf("File %s doesn't exist", rawdata.LocalPath)
+	// Flags override the manifest values
+	if rawdata.Manifest != "" {
+		LoadManifest(rawdata.Manifest, rawdata)
 	}
-
-	// Verify is not a directory
-	if file.IsDir() {
-		log.Fatalf("File %s is a directory", rawdata.LocalPath)
+	// and the existing MachineConfig provides the defaults
+	if rawdata.Into != "" {
+		loadInto(rawdata)
 	}
+	if rawdata.Roles != "" {
+		checkRoles(rawdata)
+	}
+	checkUnits(rawdata)
+	parsePasswd(rawdata)
+	checkSSHKeys(rawdata)
 
-	// TODO: Verify RemotePath is a file path
+	// Check for errors first
+	if len(rawdata.Files) == 0 && len(rawdata.Entries) == 0 && len(rawdata.Units) == 0 &&
+		len(rawdata.PasswdUsers) == 0 && len(rawdata.PasswdGroups) == 0 {
+		log.Fatalf("At least one file, directory, link, unit, user or group is required")
+	}
+	if rawdata.RemotePath != "" && len(rawdata.Files) > 1 {
+		log.Fatalf("remote can only be used with a single file, use local:remote instead")
+	}
+	if rawdata.SourceURL != "" && len(rawdata.Files) != 1 {
+		log.Fatalf("source-url can only be used with a single file")
+	}
+	if rawdata.HTTPResponseHeaders < 0 || rawdata.HTTPTotal < 0 {
+		log.Fatalf("Timeouts can't be negative")
+	}
+	if rawdata.User != "" && rawdata.UID != "" {
+		log.Fatalf("user and uid can't be used together")
+	}
+	if rawdata.Group != "" && rawdata.GID != "" {
+		log.Fatalf("group and gid can't be used together")
+	}
 
-	// Ignition 2.2 only ¯\_(ツ)_/¯
-	switch {
-	case rawdata.IgnitionVer == "":
+	// Set ignition version if not provided
+	if rawdata.IgnitionVer == "" {
+		log.Printf("ignitionversion not provided, using '%s' by default", defaultIgnitionVersion)
 		rawdata.IgnitionVer = defaultIgnitionVersion
-	case rawdata.IgnitionVer != defaultIgnitionVersion:
-		log.Fatalf("Ignition version must be %s", defaultIgnitionVersion)
-	default:
-		log.Fatalf("You shouldn't fail here...")
+	} else if !supportedIgnitionVersion(rawdata.IgnitionVer) {
+		log.Fatalf("Ignition version must be one of %s", strings.Join(ignitionVersions, ", "))
 	}
 
 	// Normalize stuff
 
-	// Remote path = local path if not explicitely used
-	if rawdata.RemotePath == "" {
-		if runtime.GOOS == "windows" {
-			log.Fatalf("If running on Windows, remote location is mandatory")
-		} else {
-			rawdata.RemotePath, err = filepath.Abs(rawdata.LocalPath)
-			if err != nil {
-				log.Fatal(err)
-			}
-			log.Printf("remote not provided, using '%s' as the original file\n", rawdata.RemotePath)
+	// Verify the output kind, a bare ignition config is a single JSON document
+	if rawdata.OutputKind == "" {
+		rawdata.OutputKind = defaultOutputKind
+	}
+	rawdata.OutputKind = strings.ToLower(rawdata.OutputKind)
+	if !stringInList(rawdata.OutputKind, outputKinds) {
+		log.Fatalf("output-kind must be one of %s", strings.Join(outputKinds, ", "))
+	}
+	if rawdata.OutputKind == outputKindIgnition {
+		switch {
+		case rawdata.Yaml:
+			log.Fatalf("Ignition configs are JSON, -yaml can't be used with --output-kind %s", outputKindIgnition)
+		case rawdata.Roles != "":
+			log.Fatalf("The ignition config is the same for every role, --roles can't be used with --output-kind %s", outputKindIgnition)
+		case rawdata.CreatePool:
+			log.Fatalf("Pools are cluster objects, --create-pool can't be used with --output-kind %s", outputKindIgnition)
+		case rawdata.OutputDir != "":
+			log.Fatalf("--output-dir writes manifests, it can't be used with --output-kind %s", outputKindIgnition)
 		}
-	} else {
-		if filepath.IsAbs(rawdata.RemotePath) == false {
-			log.Fatalf("%s is not an absolute path", rawdata.RemotePath)
+	}
+
+	// Verify the encoding, base64 by default
+	if rawdata.Content == "" {
+		rawdata.Content = defaultEncoding
+	}
+	rawdata.Content = strings.ToLower(rawdata.Content)
+	if !stringInList(rawdata.Content, encodings) {
+		log.Fatalf("encoding must be one of %s", strings.Join(encodings, ", "))
+	}
+
+	// Verify the compression mode
+	if rawdata.Compress != "" {
+		rawdata.Compress = strings.ToLower(rawdata.Compress)
+		if !stringInList(rawdata.Compress, compressionModes) {
+			log.Fatalf("compress must be one of %s", strings.Join(compressionModes, ", "))
+		}
+	}
+
+	// Owners of local files are translated to node owners
+	owners := ownerOptions{
+		NumericIDs: rawdata.NumericIDs,
+	}
+	if rawdata.OwnerMap != "" {
+		owners.Map = loadOwnerMap(rawdata.OwnerMap)
+	}
+
+	// Every node gets its own remote path, user, group and mode
+	seeds := rawdata.Entries
+	for _, spec := range rawdata.Files {
+		entry := parseFileSpec(spec)
+		if entry.RemotePath == "" {
+			entry.RemotePath = rawdata.RemotePath
 		}
+		entry.Source = rawdata.SourceURL
+		seeds = append(seeds, entry)
+	}
+	rawdata.Entries = nil
+	for _, seed := range seeds {
+		rawdata.Entries = append(rawdata.Entries, resolveEntry(seed, rawdata, owners)...)
+	}
+	checkHardLinks(rawdata.Entries)
+	checkDuplicates(rawdata.Entries)
+
+	// Owners that don't exist in RHCOS are created before the files are written
+	if rawdata.CreateOwners {
+		createOwners(rawdata)
+	}
+	checkPasswd(rawdata)
+
+	// Local CAs are embedded, remote ones are pinned by the node on its own
+	for _, ca := range rawdata.CAs {
+		rawdata.CertificateAuthorities = append(rawdata.CertificateAuthorities, caReference(ca))
 	}
 
 	// Normalize name
@@ -118,28 +412,37 @@ func CheckParameters(rawdata *Parameters) {
 		if runtime.GOOS == "windows" {
 			log.Fatalf("If running on Windows, name is mandatory")
 		} else {
-			var nodetype string
-			if strings.Contains(rawdata.Labels, "master") {
-				nodetype = "master"
-			} else {
-				nodetype = "worker"
+			// With several roles, the name is made role specific by NewMachineConfigs
+			nodetype := "worker"
+			if rawdata.Roles != "" {
+				nodetype = splitRoles(rawdata.Roles)[0]
+			} else if rawdata.Labels != "" && labelsToMap(strings.ToLower(rawdata.Labels))[roleLabel] != "" {
+				nodetype = labelsToMap(strings.ToLower(rawdata.Labels))[roleLabel]
 			}
 			r := strings.NewReplacer("/", "-", ".", "-")
-			rawdata.Name = strings.ToLower(strings.TrimSpace(defaultMachineConfigPrefix + nodetype + r.Replace(rawdata.RemotePath)))
+			rawdata.Name = strings.ToLower(strings.TrimSpace(defaultMachineConfigPrefix + nodetype + r.Replace(nameSource(rawdata))))
 			log.Printf("name not provided, using '%s' as name\n", rawdata.Name)
+			if rawdata.Roles != "" {
+				log.Printf("the role in the name is replaced for every role in '%s'", rawdata.Roles)
+			}
 		}
 	} else {
 		rawdata.Name = strings.ToLower(rawdata.Name)
 	}
 
-	// Set label if not provided
-	if rawdata.Labels == "" {
+	// Set label if not provided, the roles provide it otherwise
+	if rawdata.Labels == "" && rawdata.Roles == "" {
 		log.Printf("labels not provided, using '%s' by default", defaultLabel)
 		rawdata.Labels = strings.ToLower(defaultLabel)
-	} else {
+	} else if rawdata.Labels != "" {
 		rawdata.Labels = strings.ToLower(rawdata.Labels)
 	}
 
+	// Pools are only created for custom roles
+	if rawdata.CreatePool {
+		checkPool(rawdata)
+	}
+
 	// Set filesystem if not provided
 	if rawdata.Filesystem == "" {
 		log.Printf("filesystem not provided, using '%s' by default", defaultFilesystem)
@@ -155,39 +458,333 @@ func CheckParameters(rawdata *Parameters) {
 	} else {
 		rawdata.APIVer = strings.ToLower(rawdata.APIVer)
 	}
+}
+
+// parseFileSpec Splits a local[:remote[:mode[:user[:group]]]] file spec
+func parseFileSpec(spec string) Entry {
+	// Keep the Windows drive letter out of the split
+	volume := filepath.VolumeName(spec)
+	parts := strings.Split(strings.TrimPrefix(spec, volume), ":")
+	if len(parts) > 5 || parts[0] == "" {
+		log.Fatalf("Invalid file %s, expected local[:remote[:mode[:user[:group]]]]", spec)
+	}
+	parts = append(parts, make([]string, 5-len(parts))...)
 
-	SetUserGroupMode(file, rawdata)
+	entry := Entry{
+		LocalPath:  volume + parts[0],
+		RemotePath: parts[1],
+		User:       parts[3],
+		Group:      parts[4],
+	}
+	if parts[2] != "" {
+		mode, err := strconv.ParseInt(parts[2], 8, 0)
+		if err != nil {
+			log.Fatalf("Invalid mode %s for file %s", parts[2], spec)
+		}
+		entry.Mode = int(mode)
+	}
+	return entry
 }
 
-// NewMachineConfig Creates the MachineConfig object
-func NewMachineConfig(data Parameters) MachineConfig.MachineConfig {
+// nameSource Returns the path the default name is built from
+func nameSource(rawdata *Parameters) string {
+	switch {
+	case len(rawdata.Entries) > 0:
+		return rawdata.Entries[0].RemotePath
+	case len(rawdata.Units) > 0:
+		return "/" + rawdata.Units[0].Name
+	case len(rawdata.PasswdUsers) > 0:
+		return "/passwd-" + rawdata.PasswdUsers[0].Name
+	default:
+		return "/passwd-" + rawdata.PasswdGroups[0].Name
+	}
+}
+
+// isRemoteAbs Verify a remote path is absolute, whatever the local OS is
+func isRemoteAbs(remote string) bool {
+	return path.IsAbs(filepath.ToSlash(remote))
+}
+
+// resolveEntry Fills the missing values of an entry, walking it if it is a local directory
+func resolveEntry(entry Entry, rawdata *Parameters, owners ownerOptions) []Entry {
+	// Global flags apply when the entry doesn't set them
+	if entry.User == "" && entry.UID == nil {
+		entry.User = rawdata.User
+		entry.UID = parseID("uid", rawdata.UID)
+	}
+	if entry.Group == "" && entry.GID == nil {
+		entry.Group = rawdata.Group
+		entry.GID = parseID("gid", rawdata.GID)
+	}
+	if entry.User != "" && entry.UID != nil {
+		log.Fatalf("%s can't have both user and uid", entry.RemotePath)
+	}
+	if entry.Group != "" && entry.GID != nil {
+		log.Fatalf("%s can't have both group and gid", entry.RemotePath)
+	}
+	if entry.Mode == 0 && !entry.Directory && entry.Target == "" {
+		entry.Mode = rawdata.Mode
+	}
+
+	// Links and directories without a local copy only exist on the node
+	if entry.LocalPath == "" {
+		if isRemoteAbs(entry.RemotePath) == false {
+			log.Fatalf("%s is not an absolute path", entry.RemotePath)
+		}
+		entry.RemotePath = path.Clean(filepath.ToSlash(entry.RemotePath))
+		if entry.Directory {
+			setDefaultUserGroupMode(&entry)
+		}
+		return []Entry{entry}
+	}
+
+	// Verify file exists, links are kept as links
+	file, err := os.Lstat(entry.LocalPath)
+	if os.IsNotExist(err) {
+		log.Fatalf("File %s doesn't exist", entry.LocalPath)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	// Remote path = local path if not explicitely used
+	if entry.RemotePath == "" {
+		if runtime.GOOS == "windows" {
+			log.Fatalf("If running on Windows, remote location is mandatory")
+		} else {
+			entry.RemotePath, err = filepath.Abs(entry.LocalPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("remote not provided, using '%s' as the original file\n", entry.RemotePath)
+		}
+	} else {
+		if isRemoteAbs(entry.RemotePath) == false {
+			log.Fatalf("%s is not an absolute path", entry.RemotePath)
+		}
+	}
+	entry.RemotePath = path.Clean(filepath.ToSlash(entry.RemotePath))
+
+	if entry.Source != "" {
+		if !file.Mode().IsRegular() {
+			log.Fatalf("%s is not a regular file, source urls can only be used with files", entry.LocalPath)
+		}
+		checkSourceURL(entry.Source)
+	}
+
+	if file.Mode()&os.ModeSymlink != 0 {
+		entry.Mode = 0
+		entry.Target = readLinkTarget(entry.LocalPath, entry.RemotePath, "", "")
+		SetUserGroupMode(file, &entry, owners)
+		return []Entry{entry}
+	}
+
+	// Directories are walked, every node gets its own user/group/mode
+	if file.IsDir() {
+		return walkEntries(entry, owners)
+	}
+	SetUserGroupMode(file, &entry, owners)
+	entry.hardLinkID = hardLinkID(file)
+	return []Entry{entry}
+}
 
-	// Default content will be base64
-	fileContent := "data:text/plain;charset=utf-8;base64,"
+// readLinkTarget Returns the target of a local symlink as an absolute path on the node (required by ignition 2).
+// Absolute targets inside the local root directory are moved to the remote root directory.
+func readLinkTarget(local string, remote string, localroot string, remoteroot string) string {
+	target, err := os.Readlink(local)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !filepath.IsAbs(target) {
+		return path.Join(path.Dir(remote), filepath.ToSlash(target))
+	}
+	if localroot != "" {
+		root, err := filepath.Abs(localroot)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rel, err := filepath.Rel(root, target)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return path.Join(remoteroot, filepath.ToSlash(rel))
+		}
+	}
+	return path.Clean(filepath.ToSlash(target))
+}
 
-	// Create the base64 data with the proper ignition prefix
-	fileContent += fileToBase64(data.LocalPath)
+// checkSourceURL Verify the node is able to download a remote source
+func checkSourceURL(source string) {
+	u, err := url.Parse(source)
+	if err != nil {
+		log.Fatalf("Invalid source url %s: %s", source, err)
+	}
+	if !stringInList(u.Scheme, sourceSchemes) {
+		log.Fatalf("Invalid source url %s, the scheme must be one of %s", source, strings.Join(sourceSchemes, ", "))
+	}
+	if u.Host == "" {
+		log.Fatalf("Invalid source url %s, host is missing", source)
+	}
+}
+
+// caReference Creates a CA reference from a remote url or a local PEM file
+func caReference(ca string) igntypes.CaReference {
+	if strings.Contains(ca, "://") {
+		checkSourceURL(ca)
+		return igntypes.CaReference{
+			Source: ca,
+		}
+	}
+	contents := fileContents(Entry{LocalPath: ca}, "", defaultEncoding)
+	return igntypes.CaReference{
+		Source:       contents.Source,
+		Verification: contents.Verification,
+	}
+}
+
+// setDefaultUserGroupMode Set destination parameters of directories without a local copy
+func setDefaultUserGroupMode(entry *Entry) {
+	if entry.User == "" && entry.UID == nil {
+		log.Printf("user not provided for '%s', using '%s' by default", entry.RemotePath, defaultOwner)
+		entry.User = defaultOwner
+	}
+	if entry.Group == "" && entry.GID == nil {
+		log.Printf("group not provided for '%s', using '%s' by default", entry.RemotePath, defaultOwner)
+		entry.Group = defaultOwner
+	}
+	if entry.Mode == 0 {
+		log.Printf("mode not provided for '%s', using '%#o' by default", entry.RemotePath, defaultDirectoryMode)
+		entry.Mode = defaultDirectoryMode
+	}
+}
+
+// walkEntries Creates an entry for every file and directory found under the root entry
+func walkEntries(root Entry, owners ownerOptions) []Entry {
+	var entries []Entry
+	err := filepath.Walk(root.LocalPath, func(localpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		symlink := info.Mode()&os.ModeSymlink != 0
+		if !info.IsDir() && !info.Mode().IsRegular() && !symlink {
+			log.Printf("skipping '%s', it is not a regular file, directory or link", localpath)
+			return nil
+		}
+		rel, err := filepath.Rel(root.LocalPath, localpath)
+		if err != nil {
+			return err
+		}
+		entry := Entry{
+			LocalPath:  localpath,
+			RemotePath: path.Join(root.RemotePath, filepath.ToSlash(rel)),
+			User:       root.User,
+			Group:      root.Group,
+			UID:        root.UID,
+			GID:        root.GID,
+			Directory:  info.IsDir(),
+		}
+		// The mode provided applies to files only, directories keep their own
+		switch {
+		case symlink:
+			entry.Target = readLinkTarget(localpath, entry.RemotePath, root.LocalPath, root.RemotePath)
+		case !entry.Directory:
+			entry.Mode = root.Mode
+			entry.hardLinkID = hardLinkID(info)
+		}
+		SetUserGroupMode(info, &entry, owners)
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return entries
+}
+
+// checkHardLinks Hard linked files are written once, the rest of their links point to the first one
+func checkHardLinks(entries []Entry) {
+	first := make(map[string]string)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.hardLinkID == "" {
+			continue
+		}
+		target, ok := first[entry.hardLinkID]
+		if !ok {
+			first[entry.hardLinkID] = entry.RemotePath
+			continue
+		}
+		log.Printf("'%s' is a hard link to '%s'", entry.RemotePath, target)
+		entry.Target = target
+		entry.Hard = true
+		entry.Mode = 0
+		entry.Source = ""
+	}
+}
+
+// checkDuplicates Verify every remote path is written only once
+func checkDuplicates(entries []Entry) {
+	seen := make(map[string]string)
+	for _, entry := range entries {
+		if local, ok := seen[entry.RemotePath]; ok {
+			log.Fatalf("Remote path %s is used by both %s and %s", entry.RemotePath, local, entry.LocalPath)
+		}
+		seen[entry.RemotePath] = entry.LocalPath
+	}
+}
+
+// NewMachineConfig Creates the MachineConfig object
+func NewMachineConfig(data Parameters) MachineConfigObject {
 
 	// Create a map with the labels (as required by the machine-config struct)
 	labelmap := labelsToMap(data.Labels)
 
-	// So far, a single file is supported
-	file := make([]igntypes.File, 1)
-	file[0].FileEmbedded1 = igntypes.FileEmbedded1{
-		Mode: &data.Mode,
-		Contents: igntypes.FileContents{
-			Source: fileContent,
-		},
-	}
-	file[0].Node = igntypes.Node{
-		Filesystem: data.Filesystem,
-		Path:       data.RemotePath,
-		User: &igntypes.NodeUser{
-			Name: data.User,
-		},
-		Group: &igntypes.NodeGroup{
-			Name: data.Group,
-		},
+	var files []igntypes.File
+	var directories []igntypes.Directory
+	var links []igntypes.Link
+	for i := range data.Entries {
+		entry := &data.Entries[i]
+		node := igntypes.Node{
+			Filesystem: data.Filesystem,
+			Path:       entry.RemotePath,
+		}
+		if entry.User != "" || entry.UID != nil {
+			node.User = &igntypes.NodeUser{
+				ID:   entry.UID,
+				Name: entry.User,
+			}
+		}
+		if entry.Group != "" || entry.GID != nil {
+			node.Group = &igntypes.NodeGroup{
+				ID:   entry.GID,
+				Name: entry.Group,
+			}
+		}
+		if entry.Target != "" {
+			links = append(links, igntypes.Link{
+				Node: node,
+				LinkEmbedded1: igntypes.LinkEmbedded1{
+					Target: entry.Target,
+					Hard:   entry.Hard,
+				},
+			})
+			continue
+		}
+		if entry.Directory {
+			directories = append(directories, igntypes.Directory{
+				Node: node,
+				DirectoryEmbedded1: igntypes.DirectoryEmbedded1{
+					Mode: &entry.Mode,
+				},
+			})
+			continue
+		}
+
+		// Create the base64 data with the proper ignition prefix
+		files = append(files, igntypes.File{
+			Node: node,
+			FileEmbedded1: igntypes.FileEmbedded1{
+				Mode:     &entry.Mode,
+				Contents: fileContents(*entry, data.Compress, data.Content),
+			},
+		})
 	}
 
 	mc := MachineConfig.MachineConfig{
@@ -202,30 +799,190 @@ func NewMachineConfig(data Parameters) MachineConfig.MachineConfig {
 		Spec: MachineConfig.MachineConfigSpec{
 			Config: igntypes.Config{
 				Storage: igntypes.Storage{
-					Files: file,
+					Directories: directories,
+					Files:       files,
+					Links:       links,
+				},
+				Systemd: igntypes.Systemd{
+					Units: data.Units,
+				},
+				Passwd: igntypes.Passwd{
+					Users:  data.PasswdUsers,
+					Groups: data.PasswdGroups,
 				},
 				Ignition: igntypes.Ignition{
 					Version: data.IgnitionVer,
+					Security: igntypes.Security{
+						TLS: igntypes.TLS{
+							CertificateAuthorities: data.CertificateAuthorities,
+						},
+					},
+					Timeouts: timeouts(data),
 				},
 			},
 		},
 	}
 
-	return mc
+	if data.Into != "" {
+		return mergeInto(LoadMachineConfig(data.Into), mc)
+	}
+	return MachineConfigObject{MachineConfig: mc}
+}
+
+// stringInList Verify a string is part of a list
+func stringInList(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// timeouts Returns the ignition timeouts, only the ones provided are set
+func timeouts(data Parameters) igntypes.Timeouts {
+	var t igntypes.Timeouts
+	if data.HTTPResponseHeaders > 0 {
+		t.HTTPResponseHeaders = &data.HTTPResponseHeaders
+	}
+	if data.HTTPTotal > 0 {
+		t.HTTPTotal = &data.HTTPTotal
+	}
+	return t
+}
+
+// supportedIgnitionVersion Verify the ignition version can be generated
+func supportedIgnitionVersion(version string) bool {
+	return stringInList(version, ignitionVersions)
+}
+
+// machineConfigRaw MachineConfig with spec.config as a raw extension, used for versions other than 2.2
+type machineConfigRaw struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec machineConfigRawSpec `json:"spec"`
+}
+
+type machineConfigRawSpec struct {
+	OSImageURL string                  `json:"osImageURL"`
+	Config     k8sruntime.RawExtension `json:"config"`
+}
+
+// machineConfigFields MachineConfig with the spec fields the vendored types don't have
+type machineConfigFields struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec map[string]interface{} `json:"spec"`
+}
+
+// renderConfig Returns the ignition config in the version it declares
+func renderConfig(cfg igntypes.Config) interface{} {
+	switch {
+	case strings.HasPrefix(cfg.Ignition.Version, "3."):
+		return translateToV3(cfg, cfg.Ignition.Version)
+	case cfg.Ignition.Version == "2.1.0":
+		return translateToV2_1(cfg)
+	case cfg.Ignition.Version == "2.0.0":
+		return translateToV2_0(translateToV2_1(cfg))
+	default:
+		return cfg
+	}
+}
+
+// renderMachineConfig Returns the object to be printed for a MachineConfig
+func renderMachineConfig(mc MachineConfigObject) interface{} {
+	if len(mc.SpecFields) > 0 {
+		spec := make(map[string]interface{})
+		for k, v := range mc.SpecFields {
+			spec[k] = v
+		}
+		spec["osImageURL"] = mc.Spec.OSImageURL
+		spec["config"] = renderConfig(mc.Spec.Config)
+		return machineConfigFields{
+			TypeMeta:   mc.TypeMeta,
+			ObjectMeta: mc.ObjectMeta,
+			Spec:       spec,
+		}
+	}
+	if mc.Spec.Config.Ignition.Version == defaultIgnitionVersion {
+		return mc.MachineConfig
+	}
+	raw, err := json.Marshal(renderConfig(mc.Spec.Config))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return machineConfigRaw{
+		TypeMeta:   mc.TypeMeta,
+		ObjectMeta: mc.ObjectMeta,
+		Spec: machineConfigRawSpec{
+			OSImageURL: mc.Spec.OSImageURL,
+			Config:     k8sruntime.RawExtension{Raw: raw},
+		},
+	}
 }
 
 // MachineConfigOutput Convert a MachineConfig to a string
-func MachineConfigOutput(mc MachineConfig.MachineConfig, mode string) string {
+func MachineConfigOutput(mc MachineConfigObject, mode string) string {
+	return objectOutput(renderMachineConfig(mc), mode)
+}
+
+// IgnitionOutput Convert the config of a MachineConfig to a standalone ignition config, in the version it declares
+func IgnitionOutput(mc MachineConfigObject) string {
+	for _, field := range specFieldNames(mc) {
+		log.Printf("spec.%s of the MachineConfig is not part of the ignition config, it's not printed", field)
+	}
+	return objectOutput(renderConfig(mc.Spec.Config), "json")
+}
+
+// ObjectsOutput Convert the MachineConfigs and MachineConfigPools to a string, a YAML stream or a JSON List if there are several
+func ObjectsOutput(mcs []MachineConfigObject, pools []MachineConfig.MachineConfigPool, mode string) string {
+	var objects []interface{}
+	for _, mc := range mcs {
+		objects = append(objects, renderMachineConfig(mc))
+	}
+	for _, pool := range pools {
+		objects = append(objects, renderMachineConfigPool(pool))
+	}
+	if len(objects) == 1 {
+		return objectOutput(objects[0], mode)
+	}
+	return objectsOutput(objects, mode)
+}
+
+// objectsOutput Convert several objects to a string, a YAML stream or a JSON List
+func objectsOutput(objects []interface{}, mode string) string {
+	if mode == "yaml" {
+		var documents []string
+		for _, object := range objects {
+			documents = append(documents, objectOutput(object, mode))
+		}
+		return strings.Join(documents, "---\n")
+	}
+	return objectOutput(objectList{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"},
+		Items:    objects,
+	}, mode)
+}
+
+// objectList The v1 List kubectl/oc accept
+type objectList struct {
+	metav1.TypeMeta `json:",inline"`
+	Items           []interface{} `json:"items"`
+}
 
+// objectOutput Convert an object to a string
+func objectOutput(object interface{}, mode string) string {
 	switch {
 	case mode == "json":
-		b, err := json.Marshal(mc)
+		b, err := json.Marshal(object)
 		if err != nil {
 			log.Fatal(err)
 		}
 		return string(b)
 	case mode == "yaml":
-		b, err := yaml.Marshal(mc)
+		b, err := yaml.Marshal(object)
 		if err != nil {
 			log.Fatal(err)
 		}
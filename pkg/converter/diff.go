@@ -0,0 +1,439 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+)
+
+// Lines of context around the changes of a unified diff
+var diffContext = 3
+
+// Contents bigger than this (lines a * lines b) are not diffed line by line
+var maxDiffCells = 16 * 1024 * 1024
+
+// diffOp A line of an edit script, kind is ' ', '-' or '+'
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// splitLines Splits content in lines without the line endings
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// diffLines Returns the edit script turning a into b (longest common subsequence)
+func diffLines(a []string, b []string) []diffOp {
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// hunkRange Formats the range of a hunk header
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// unifiedDiff Returns the unified diff of two contents, empty if they are the same
+func unifiedDiff(fromname string, toname string, from string, to string) string {
+	if from == to {
+		return ""
+	}
+	a, b := splitLines(from), splitLines(to)
+	if len(a)*len(b) > maxDiffCells {
+		return fmt.Sprintf("contents differ (%d and %d lines, too big to diff)\n", len(a), len(b))
+	}
+	ops := diffLines(a, b)
+
+	// Line numbers of every op in a and b
+	apos := make([]int, len(ops)+1)
+	bpos := make([]int, len(ops)+1)
+	for k, op := range ops {
+		apos[k+1], bpos[k+1] = apos[k], bpos[k]
+		if op.kind != '+' {
+			apos[k+1]++
+		}
+		if op.kind != '-' {
+			bpos[k+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromname, toname)
+	changes := false
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		changes = true
+		// Extend the hunk while the next change is close enough
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(ops) {
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				break
+			}
+			for next < len(ops) && ops[next].kind != ' ' {
+				next++
+			}
+			end = next
+		}
+		end += diffContext
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(apos[start], apos[end]-apos[start]), hunkRange(bpos[start], bpos[end]-bpos[start]))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+		k = end
+	}
+	if !changes {
+		fmt.Fprintf(&out, "only the newline at the end of the file differs\n")
+	}
+	return out.String()
+}
+
+// diffPrinter Writes the differences found, remembering if there is any
+type diffPrinter struct {
+	w       io.Writer
+	changes bool
+}
+
+func (p *diffPrinter) printf(format string, args ...interface{}) {
+	p.changes = true
+	fmt.Fprintf(p.w, format, args...)
+}
+
+// diffValue Reports a changed field
+func (p *diffPrinter) diffValue(what string, from interface{}, to interface{}) {
+	if !reflect.DeepEqual(from, to) {
+		p.printf("~ %s: %v -> %v\n", what, from, to)
+	}
+}
+
+// describeContents Returns the decoded content of a file, or a description if it can't be decoded or isn't text
+func describeContents(contents igntypes.FileContents) string {
+	content, err := decodeSource(contents.Source, contents.Compression)
+	if err != nil {
+		return fmt.Sprintf("source %s, hash %s\n", contents.Source, hashString(contents.Verification))
+	}
+	if !isText(content) {
+		sum, _ := contentHash(defaultHashFunction, content)
+		return fmt.Sprintf("binary, %d bytes, %s\n", len(content), sum)
+	}
+	return string(content)
+}
+
+// hashString Returns the recorded hash, none if there is no hash
+func hashString(v igntypes.Verification) string {
+	if v.Hash == nil {
+		return "none"
+	}
+	return *v.Hash
+}
+
+// diffText Reports the differences of two text contents
+func (p *diffPrinter) diffText(what string, from string, to string) {
+	if diff := unifiedDiff("a"+what, "b"+what, from, to); diff != "" {
+		p.printf("%s", diff)
+	}
+}
+
+// sortedKeys Returns the keys of both maps, sorted
+func sortedKeys(a map[string]string, b map[string]string) []string {
+	var keys []string
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// specFieldValues Returns the spec fields the vendored types don't have as compact JSON, formatting doesn't count
+func specFieldValues(mc MachineConfigObject) map[string]string {
+	values := make(map[string]string)
+	for name, raw := range mc.SpecFields {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			log.Fatalf("Invalid spec.%s in MachineConfig %s: %s", name, mc.Name, err)
+		}
+		values[name] = jsonString(value)
+	}
+	return values
+}
+
+// diffMeta Reports name, label and spec field (kernelArguments, fips...) changes
+func (p *diffPrinter) diffMeta(a MachineConfigObject, b MachineConfigObject) {
+	p.diffValue("name", a.Name, b.Name)
+	for _, k := range sortedKeys(a.Labels, b.Labels) {
+		from, infrom := a.Labels[k]
+		to, into := b.Labels[k]
+		switch {
+		case !infrom:
+			p.printf("+ label %s: %s\n", k, to)
+		case !into:
+			p.printf("- label %s: %s\n", k, from)
+		default:
+			p.diffValue("label "+k, from, to)
+		}
+	}
+	p.diffValue("ignition version", a.Spec.Config.Ignition.Version, b.Spec.Config.Ignition.Version)
+	p.diffValue("osImageURL", a.Spec.OSImageURL, b.Spec.OSImageURL)
+
+	fieldsa, fieldsb := specFieldValues(a), specFieldValues(b)
+	for _, k := range sortedKeys(fieldsa, fieldsb) {
+		from, infrom := fieldsa[k]
+		to, into := fieldsb[k]
+		switch {
+		case !infrom:
+			p.printf("+ spec.%s: %s\n", k, to)
+		case !into:
+			p.printf("- spec.%s: %s\n", k, from)
+		default:
+			p.diffValue("spec."+k, from, to)
+		}
+	}
+}
+
+// diffFiles Reports added, removed and changed files, text contents as unified diffs
+func (p *diffPrinter) diffFiles(a []igntypes.File, b []igntypes.File) {
+	from := make(map[string]igntypes.File)
+	var paths []string
+	for _, f := range a {
+		from[f.Path] = f
+		paths = append(paths, f.Path)
+	}
+	to := make(map[string]igntypes.File)
+	for _, f := range b {
+		to[f.Path] = f
+		if _, ok := from[f.Path]; !ok {
+			paths = append(paths, f.Path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		fa, ina := from[path]
+		fb, inb := to[path]
+		switch {
+		case !ina:
+			content := describeContents(fb.Contents)
+			p.printf("+ file %s (%#o %s)\n", path, nodeMode(fb.Mode, defaultFileMode), nodeOwner(fb.Node))
+			p.diffText(path, "", content)
+		case !inb:
+			p.printf("- file %s (%#o %s)\n", path, nodeMode(fa.Mode, defaultFileMode), nodeOwner(fa.Node))
+		default:
+			p.diffValue("file "+path+" mode", fmt.Sprintf("%#o", nodeMode(fa.Mode, defaultFileMode)), fmt.Sprintf("%#o", nodeMode(fb.Mode, defaultFileMode)))
+			p.diffValue("file "+path+" owner", nodeOwner(fa.Node), nodeOwner(fb.Node))
+			p.diffValue("file "+path+" append", fa.Append, fb.Append)
+			p.diffValue("file "+path+" overwrite", fileOverwrite(fa), fileOverwrite(fb))
+			p.diffValue("file "+path+" filesystem", fa.Filesystem, fb.Filesystem)
+			ca := describeContents(fa.Contents)
+			cb := describeContents(fb.Contents)
+			p.diffText(path, ca, cb)
+		}
+	}
+}
+
+// fileOverwrite Returns whether a file replaces the existing one, spec 2 overwrites by default
+func fileOverwrite(f igntypes.File) bool {
+	return f.Overwrite == nil || *f.Overwrite
+}
+
+// diffDirectories Reports added, removed and changed directories
+func (p *diffPrinter) diffDirectories(a []igntypes.Directory, b []igntypes.Directory) {
+	from := make(map[string]igntypes.Directory)
+	for _, d := range a {
+		from[d.Path] = d
+	}
+	to := make(map[string]igntypes.Directory)
+	for _, d := range b {
+		to[d.Path] = d
+		da, ok := from[d.Path]
+		if !ok {
+			p.printf("+ directory %s (%#o %s)\n", d.Path, nodeMode(d.Mode, defaultDirectoryMode), nodeOwner(d.Node))
+			continue
+		}
+		p.diffValue("directory "+d.Path+" mode", fmt.Sprintf("%#o", nodeMode(da.Mode, defaultDirectoryMode)), fmt.Sprintf("%#o", nodeMode(d.Mode, defaultDirectoryMode)))
+		p.diffValue("directory "+d.Path+" owner", nodeOwner(da.Node), nodeOwner(d.Node))
+	}
+	for _, d := range a {
+		if _, ok := to[d.Path]; !ok {
+			p.printf("- directory %s\n", d.Path)
+		}
+	}
+}
+
+// diffLinks Reports added, removed and changed links
+func (p *diffPrinter) diffLinks(a []igntypes.Link, b []igntypes.Link) {
+	from := make(map[string]igntypes.Link)
+	for _, l := range a {
+		from[l.Path] = l
+	}
+	to := make(map[string]igntypes.Link)
+	for _, l := range b {
+		to[l.Path] = l
+		la, ok := from[l.Path]
+		if !ok {
+			p.printf("+ link %s -> %s\n", l.Path, l.Target)
+			continue
+		}
+		p.diffValue("link "+l.Path+" target", la.Target, l.Target)
+		p.diffValue("link "+l.Path+" hard", la.Hard, l.Hard)
+		p.diffValue("link "+l.Path+" owner", nodeOwner(la.Node), nodeOwner(l.Node))
+	}
+	for _, l := range a {
+		if _, ok := to[l.Path]; !ok {
+			p.printf("- link %s -> %s\n", l.Path, l.Target)
+		}
+	}
+}
+
+// diffUnits Reports added, removed and changed units and dropins
+func (p *diffPrinter) diffUnits(a []igntypes.Unit, b []igntypes.Unit) {
+	for _, u := range b {
+		i := findUnitIn(a, u.Name)
+		if i < 0 {
+			p.printf("+ unit %s (%s)\n", u.Name, unitState(u))
+			p.diffText("/"+u.Name, "", u.Contents)
+			continue
+		}
+		ua := a[i]
+		p.diffValue("unit "+u.Name, unitState(ua), unitState(u))
+		p.diffText("/"+u.Name, ua.Contents, u.Contents)
+
+		for _, d := range u.Dropins {
+			found := false
+			for _, da := range ua.Dropins {
+				if da.Name == d.Name {
+					found = true
+					p.diffText("/"+u.Name+".d/"+d.Name, da.Contents, d.Contents)
+				}
+			}
+			if !found {
+				p.printf("+ dropin %s of unit %s\n", d.Name, u.Name)
+				p.diffText("/"+u.Name+".d/"+d.Name, "", d.Contents)
+			}
+		}
+		for _, da := range ua.Dropins {
+			found := false
+			for _, d := range u.Dropins {
+				found = found || d.Name == da.Name
+			}
+			if !found {
+				p.printf("- dropin %s of unit %s\n", da.Name, u.Name)
+			}
+		}
+	}
+	for _, u := range a {
+		if findUnitIn(b, u.Name) < 0 {
+			p.printf("- unit %s\n", u.Name)
+		}
+	}
+}
+
+// diffPasswd Reports added, removed and changed users and groups
+func (p *diffPrinter) diffPasswd(a igntypes.Passwd, b igntypes.Passwd) {
+	for _, u := range b.Users {
+		i := findPasswdUser(a.Users, u.Name)
+		switch {
+		case i < 0:
+			p.printf("+ user %s\n", u.Name)
+		case !reflect.DeepEqual(a.Users[i], u):
+			p.printf("~ user %s changed\n", u.Name)
+		}
+	}
+	for _, u := range a.Users {
+		if findPasswdUser(b.Users, u.Name) < 0 {
+			p.printf("- user %s\n", u.Name)
+		}
+	}
+	for _, g := range b.Groups {
+		i := findPasswdGroup(a.Groups, g.Name)
+		switch {
+		case i < 0:
+			p.printf("+ group %s\n", g.Name)
+		case !reflect.DeepEqual(a.Groups[i], g):
+			p.printf("~ group %s changed\n", g.Name)
+		}
+	}
+	for _, g := range a.Groups {
+		if findPasswdGroup(b.Groups, g.Name) < 0 {
+			p.printf("- group %s\n", g.Name)
+		}
+	}
+}
+
+// DiffMachineConfigs Writes the differences between two MachineConfigs, returns false if they are the same
+func DiffMachineConfigs(a MachineConfigObject, b MachineConfigObject, w io.Writer) bool {
+	p := &diffPrinter{w: w}
+	p.diffMeta(a, b)
+	p.diffFiles(a.Spec.Config.Storage.Files, b.Spec.Config.Storage.Files)
+	p.diffDirectories(a.Spec.Config.Storage.Directories, b.Spec.Config.Storage.Directories)
+	p.diffLinks(a.Spec.Config.Storage.Links, b.Spec.Config.Storage.Links)
+	p.diffUnits(a.Spec.Config.Systemd.Units, b.Spec.Config.Systemd.Units)
+	p.diffPasswd(a.Spec.Config.Passwd, b.Spec.Config.Passwd)
+	return p.changes
+}
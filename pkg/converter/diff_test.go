@@ -0,0 +1,116 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestHunkRange(t *testing.T) {
+	tests := []struct {
+		start int
+		count int
+		want  string
+	}{
+		{0, 0, "0,0"},
+		{4, 0, "4,0"},
+		{0, 1, "1"},
+		{6, 1, "7"},
+		{0, 2, "1,2"},
+		{1, 7, "2,7"},
+	}
+	for _, tt := range tests {
+		if got := hunkRange(tt.start, tt.count); got != tt.want {
+			t.Errorf("hunkRange(%d, %d) = %q, want %q", tt.start, tt.count, got, tt.want)
+		}
+	}
+}
+
+// The expected diffs are the output of diff -u
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{
+			name: "identical",
+			from: "1\n2\n",
+			to:   "1\n2\n",
+			want: "",
+		},
+		{
+			name: "middle",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			to:   "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n",
+			want: "--- a/x\n+++ b/x\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "append",
+			from: "1\n2\n3\n4\n5\n",
+			to:   "1\n2\n3\n4\n5\n6\n",
+			want: "--- a/x\n+++ b/x\n@@ -3,3 +3,4 @@\n 3\n 4\n 5\n+6\n",
+		},
+		{
+			name: "remove all",
+			from: "1\n2\n",
+			to:   "",
+			want: "--- a/x\n+++ b/x\n@@ -1,2 +0,0 @@\n-1\n-2\n",
+		},
+		{
+			name: "create",
+			from: "",
+			to:   "1\n2\n",
+			want: "--- a/x\n+++ b/x\n@@ -0,0 +1,2 @@\n+1\n+2\n",
+		},
+		{
+			name: "changes 6 lines apart share a hunk",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n",
+			to:   "x\n2\n3\n4\n5\n6\n7\ny\n9\n10\n11\n12\n13\n14\n15\n16\n",
+			want: "--- a/x\n+++ b/x\n@@ -1,11 +1,11 @@\n-1\n+x\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n 9\n 10\n 11\n",
+		},
+		{
+			name: "changes 7 lines apart get a hunk each",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n",
+			to:   "x\n2\n3\n4\n5\n6\n7\n8\ny\n10\n11\n12\n13\n14\n15\n16\n",
+			want: "--- a/x\n+++ b/x\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -6,7 +6,7 @@\n 6\n 7\n 8\n-9\n+y\n 10\n 11\n 12\n",
+		},
+		{
+			name: "newline at the end",
+			from: "1\n2",
+			to:   "1\n2\n",
+			want: "--- a/x\n+++ b/x\nonly the newline at the end of the file differs\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := unifiedDiff("a/x", "b/x", tt.from, tt.to); got != tt.want {
+			t.Errorf("%s: unifiedDiff() =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiffMachineConfigsSpecFields(t *testing.T) {
+	a := MachineConfigObject{SpecFields: map[string]json.RawMessage{
+		"fips":            json.RawMessage(`true`),
+		"kernelArguments": json.RawMessage(`["nosmt"]`),
+	}}
+	b := MachineConfigObject{SpecFields: map[string]json.RawMessage{
+		"kernelArguments": json.RawMessage(`[ "nosmt", "mitigations=off" ]`),
+	}}
+	var out bytes.Buffer
+	if !DiffMachineConfigs(a, b, &out) {
+		t.Fatalf("DiffMachineConfigs() found no difference")
+	}
+	want := "- spec.fips: true\n~ spec.kernelArguments: [\"nosmt\"] -> [\"nosmt\",\"mitigations=off\"]\n"
+	if out.String() != want {
+		t.Errorf("DiffMachineConfigs() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	// Formatting isn't a difference
+	a.SpecFields = map[string]json.RawMessage{"kernelArguments": json.RawMessage(`["nosmt","mitigations=off"]`)}
+	out.Reset()
+	if DiffMachineConfigs(a, b, &out) {
+		t.Errorf("DiffMachineConfigs() reported %q for the same values", out.String())
+	}
+}
@@ -0,0 +1,162 @@
+package converter
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+)
+
+// Ignition defaults when the mode is not set
+var defaultFileMode = 0644
+var systemdUnitsDir = "/etc/systemd/system"
+
+// nodeOwner Returns the user:group owning a node, root if not set
+func nodeOwner(node igntypes.Node) string {
+	user, group := defaultOwner, defaultOwner
+	if node.User != nil {
+		user = node.User.Name
+		if node.User.ID != nil {
+			user = strconv.Itoa(*node.User.ID)
+		}
+	}
+	if node.Group != nil {
+		group = node.Group.Name
+		if node.Group.ID != nil {
+			group = strconv.Itoa(*node.Group.ID)
+		}
+	}
+	return user + ":" + group
+}
+
+// nodeMode Returns the mode of a node, the default one if not set
+func nodeMode(mode *int, defaultmode int) os.FileMode {
+	if mode == nil {
+		return os.FileMode(defaultmode)
+	}
+	return os.FileMode(*mode)
+}
+
+// unitState Returns how a unit is configured
+func unitState(u igntypes.Unit) string {
+	var state []string
+	switch {
+	case u.Mask:
+		state = append(state, "masked")
+	case u.Enabled != nil && *u.Enabled, u.Enable:
+		state = append(state, "enabled")
+	case u.Enabled != nil:
+		state = append(state, "disabled")
+	}
+	if u.Contents == "" {
+		state = append(state, "no contents")
+	}
+	for _, d := range u.Dropins {
+		state = append(state, "dropin "+d.Name)
+	}
+	return strings.Join(state, ", ")
+}
+
+// extractPath Returns the local path of a node path under the output directory
+func extractPath(dir string, remote string) string {
+	// Clean the absolute path first so it can't escape the output directory
+	return filepath.Join(dir, filepath.FromSlash(path.Clean("/"+remote)))
+}
+
+// writeExtracted Write a file creating its parent directories
+func writeExtracted(file string, content []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), os.FileMode(defaultDirectoryMode)); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, content, mode); err != nil {
+		return err
+	}
+	// WriteFile only sets the mode of new files and is subject to the umask
+	return os.Chmod(file, mode)
+}
+
+// ExtractMachineConfig Writes the files, directories and units of a MachineConfig under dir and reports every node
+func ExtractMachineConfig(mc MachineConfigObject, dir string, out io.Writer) {
+	cfg := mc.Spec.Config
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	// Directory modes are set at the end, they could prevent writing the files inside
+	for _, d := range cfg.Storage.Directories {
+		mode := nodeMode(d.Mode, defaultDirectoryMode)
+		if err := os.MkdirAll(extractPath(dir, d.Path), os.FileMode(defaultDirectoryMode)); err != nil {
+			log.Fatal(err)
+		}
+		defer os.Chmod(extractPath(dir, d.Path), mode)
+		fmt.Fprintf(w, "directory\t%s\t%#o\t%s\n", d.Path, mode, nodeOwner(d.Node))
+	}
+
+	for _, f := range cfg.Storage.Files {
+		mode := nodeMode(f.Mode, defaultFileMode)
+		var details []string
+		if f.Append {
+			details = append(details, "append")
+		}
+		if f.Contents.Compression != "" {
+			details = append(details, f.Contents.Compression)
+		}
+		content, err := decodeSource(f.Contents.Source, f.Contents.Compression)
+		if err != nil {
+			details = append(details, "not extracted: "+err.Error())
+		} else {
+			if err := writeExtracted(extractPath(dir, f.Path), content, mode); err != nil {
+				log.Fatal(err)
+			}
+			details = append(details, fmt.Sprintf("%d bytes", len(content)))
+		}
+		fmt.Fprintf(w, "file\t%s\t%#o\t%s\t%s\n", f.Path, mode, nodeOwner(f.Node), strings.Join(details, ", "))
+	}
+
+	for _, l := range cfg.Storage.Links {
+		kind := "symlink"
+		if l.Hard {
+			kind = "hardlink"
+		}
+		fmt.Fprintf(w, "%s\t%s\t\t%s\t-> %s\n", kind, l.Path, nodeOwner(l.Node), l.Target)
+	}
+
+	for _, u := range cfg.Systemd.Units {
+		if u.Contents != "" {
+			if err := writeExtracted(extractPath(dir, path.Join(systemdUnitsDir, u.Name)), []byte(u.Contents), os.FileMode(defaultFileMode)); err != nil {
+				log.Fatal(err)
+			}
+		}
+		for _, d := range u.Dropins {
+			if err := writeExtracted(extractPath(dir, path.Join(systemdUnitsDir, u.Name+".d", d.Name)), []byte(d.Contents), os.FileMode(defaultFileMode)); err != nil {
+				log.Fatal(err)
+			}
+		}
+		fmt.Fprintf(w, "unit\t%s\t\t\t%s\n", u.Name, unitState(u))
+	}
+
+	for _, g := range cfg.Passwd.Groups {
+		gid := ""
+		if g.Gid != nil {
+			gid = "gid " + strconv.Itoa(*g.Gid)
+		}
+		fmt.Fprintf(w, "group\t%s\t\t\t%s\n", g.Name, gid)
+	}
+	for _, u := range cfg.Passwd.Users {
+		var details []string
+		if u.UID != nil {
+			details = append(details, "uid "+strconv.Itoa(*u.UID))
+		}
+		if len(u.SSHAuthorizedKeys) > 0 {
+			details = append(details, fmt.Sprintf("%d ssh keys", len(u.SSHAuthorizedKeys)))
+		}
+		fmt.Fprintf(w, "user\t%s\t\t\t%s\n", u.Name, strings.Join(details, ", "))
+	}
+}
@@ -0,0 +1,333 @@
+package converter
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+
+	v2_0types "github.com/coreos/ignition/config/v2_0/types"
+	v2_1types "github.com/coreos/ignition/config/v2_1/types"
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+)
+
+// The vendored translators only go from older to newer specs, these go the other way
+// and fail when the config uses something the older spec can't express.
+
+// legacyUnsupported Fail because the requested version lacks a feature
+func legacyUnsupported(version string, feature string, minimum string) {
+	log.Fatalf("Ignition %s doesn't support %s, it requires Ignition %s or newer", version, feature, minimum)
+}
+
+// translateToV2_1 Converts the spec 2.2 config built by NewMachineConfig to spec 2.1
+func translateToV2_1(cfg igntypes.Config) v2_1types.Config {
+	version := "2.1.0"
+	if len(cfg.Storage.Disks) > 0 || len(cfg.Storage.Raid) > 0 || len(cfg.Storage.Filesystems) > 0 {
+		log.Fatalf("disks, raid and filesystems can't be translated to Ignition %s", version)
+	}
+	if len(cfg.Ignition.Security.TLS.CertificateAuthorities) > 0 {
+		legacyUnsupported(version, "ignition.security.tls", "2.2.0")
+	}
+
+	translateReference := func(ref igntypes.ConfigReference) v2_1types.ConfigReference {
+		return v2_1types.ConfigReference{
+			Source:       ref.Source,
+			Verification: v2_1types.Verification{Hash: ref.Verification.Hash},
+		}
+	}
+	translateNode := func(node igntypes.Node) v2_1types.Node {
+		if node.Overwrite != nil {
+			legacyUnsupported(version, "overwrite ("+node.Path+")", "2.2.0")
+		}
+		out := v2_1types.Node{
+			Filesystem: node.Filesystem,
+			Path:       node.Path,
+		}
+		if node.User != nil {
+			out.User = v2_1types.NodeUser{ID: node.User.ID, Name: node.User.Name}
+		}
+		if node.Group != nil {
+			out.Group = v2_1types.NodeGroup{ID: node.Group.ID, Name: node.Group.Name}
+		}
+		return out
+	}
+	mode := func(m *int) int {
+		if m == nil {
+			return 0
+		}
+		return *m
+	}
+
+	out := v2_1types.Config{
+		Ignition: v2_1types.Ignition{
+			Version: version,
+			Timeouts: v2_1types.Timeouts{
+				HTTPResponseHeaders: cfg.Ignition.Timeouts.HTTPResponseHeaders,
+				HTTPTotal:           cfg.Ignition.Timeouts.HTTPTotal,
+			},
+		},
+	}
+	for _, ref := range cfg.Ignition.Config.Append {
+		out.Ignition.Config.Append = append(out.Ignition.Config.Append, translateReference(ref))
+	}
+	if cfg.Ignition.Config.Replace != nil {
+		ref := translateReference(*cfg.Ignition.Config.Replace)
+		out.Ignition.Config.Replace = &ref
+	}
+
+	for _, f := range cfg.Storage.Files {
+		if f.Append {
+			legacyUnsupported(version, "append ("+f.Path+")", "2.2.0")
+		}
+		out.Storage.Files = append(out.Storage.Files, v2_1types.File{
+			Node: translateNode(f.Node),
+			FileEmbedded1: v2_1types.FileEmbedded1{
+				Mode: mode(f.Mode),
+				Contents: v2_1types.FileContents{
+					Compression:  f.Contents.Compression,
+					Source:       f.Contents.Source,
+					Verification: v2_1types.Verification{Hash: f.Contents.Verification.Hash},
+				},
+			},
+		})
+	}
+	for _, d := range cfg.Storage.Directories {
+		out.Storage.Directories = append(out.Storage.Directories, v2_1types.Directory{
+			Node:               translateNode(d.Node),
+			DirectoryEmbedded1: v2_1types.DirectoryEmbedded1{Mode: mode(d.Mode)},
+		})
+	}
+	for _, l := range cfg.Storage.Links {
+		out.Storage.Links = append(out.Storage.Links, v2_1types.Link{
+			Node:          translateNode(l.Node),
+			LinkEmbedded1: v2_1types.LinkEmbedded1{Hard: l.Hard, Target: l.Target},
+		})
+	}
+
+	for _, u := range cfg.Systemd.Units {
+		unit := v2_1types.Unit{
+			Contents: u.Contents,
+			Enable:   u.Enable,
+			Enabled:  u.Enabled,
+			Mask:     u.Mask,
+			Name:     u.Name,
+		}
+		for _, d := range u.Dropins {
+			unit.Dropins = append(unit.Dropins, v2_1types.Dropin{Contents: d.Contents, Name: d.Name})
+		}
+		out.Systemd.Units = append(out.Systemd.Units, unit)
+	}
+	for _, u := range cfg.Networkd.Units {
+		if len(u.Dropins) > 0 {
+			legacyUnsupported(version, "networkd dropins ("+u.Name+")", "2.2.0")
+		}
+		out.Networkd.Units = append(out.Networkd.Units, v2_1types.Networkdunit{Contents: u.Contents, Name: u.Name})
+	}
+
+	for _, g := range cfg.Passwd.Groups {
+		out.Passwd.Groups = append(out.Passwd.Groups, v2_1types.PasswdGroup{
+			Gid:          g.Gid,
+			Name:         g.Name,
+			PasswordHash: g.PasswordHash,
+			System:       g.System,
+		})
+	}
+	for _, u := range cfg.Passwd.Users {
+		user := v2_1types.PasswdUser{
+			Gecos:        u.Gecos,
+			HomeDir:      u.HomeDir,
+			Name:         u.Name,
+			NoCreateHome: u.NoCreateHome,
+			NoLogInit:    u.NoLogInit,
+			NoUserGroup:  u.NoUserGroup,
+			PasswordHash: u.PasswordHash,
+			PrimaryGroup: u.PrimaryGroup,
+			Shell:        u.Shell,
+			System:       u.System,
+			UID:          u.UID,
+		}
+		for _, g := range u.Groups {
+			user.Groups = append(user.Groups, v2_1types.PasswdUserGroup(g))
+		}
+		for _, k := range u.SSHAuthorizedKeys {
+			user.SSHAuthorizedKeys = append(user.SSHAuthorizedKeys, v2_1types.SSHAuthorizedKey(k))
+		}
+		if u.Create != nil {
+			user.Create = &v2_1types.Usercreate{
+				Gecos:        u.Create.Gecos,
+				HomeDir:      u.Create.HomeDir,
+				NoCreateHome: u.Create.NoCreateHome,
+				NoLogInit:    u.Create.NoLogInit,
+				NoUserGroup:  u.Create.NoUserGroup,
+				PrimaryGroup: u.Create.PrimaryGroup,
+				Shell:        u.Create.Shell,
+				System:       u.Create.System,
+				UID:          u.Create.UID,
+			}
+			for _, g := range u.Create.Groups {
+				user.Create.Groups = append(user.Create.Groups, v2_1types.UsercreateGroup(g))
+			}
+		}
+		out.Passwd.Users = append(out.Passwd.Users, user)
+	}
+
+	return out
+}
+
+// translateToV2_0 Converts a spec 2.1 config to spec 2.0
+func translateToV2_0(cfg v2_1types.Config) v2_0types.Config {
+	version := "2.0.0"
+	if len(cfg.Storage.Directories) > 0 {
+		legacyUnsupported(version, "storage.directories", "2.1.0")
+	}
+	if len(cfg.Storage.Links) > 0 {
+		legacyUnsupported(version, "storage.links", "2.1.0")
+	}
+	if cfg.Ignition.Timeouts.HTTPResponseHeaders != nil || cfg.Ignition.Timeouts.HTTPTotal != nil {
+		legacyUnsupported(version, "ignition.timeouts", "2.1.0")
+	}
+
+	translateURL := func(source string) v2_0types.Url {
+		u, err := url.Parse(source)
+		if err != nil {
+			log.Fatalf("Invalid source %s: %s", source, err)
+		}
+		switch u.Scheme {
+		case "s3", "tftp":
+			legacyUnsupported(version, u.Scheme+" sources", "2.1.0")
+		}
+		return v2_0types.Url(*u)
+	}
+	translateVerification := func(v v2_1types.Verification) v2_0types.Verification {
+		var out v2_0types.Verification
+		if v.Hash != nil {
+			parts := strings.SplitN(*v.Hash, "-", 2)
+			if len(parts) != 2 {
+				log.Fatalf("Invalid hash %s", *v.Hash)
+			}
+			out.Hash = &v2_0types.Hash{Function: parts[0], Sum: parts[1]}
+		}
+		return out
+	}
+	translateReference := func(ref v2_1types.ConfigReference) v2_0types.ConfigReference {
+		return v2_0types.ConfigReference{
+			Source:       translateURL(ref.Source),
+			Verification: translateVerification(ref.Verification),
+		}
+	}
+	// Spec 2.0 only knows numeric owners, unset means root
+	ownerID := func(path string, id *int, name string) int {
+		if name != "" {
+			legacyUnsupported(version, "user and group names ("+path+")", "2.1.0")
+		}
+		if id == nil {
+			return 0
+		}
+		return *id
+	}
+	uid := func(id *int) *uint {
+		if id == nil {
+			return nil
+		}
+		u := uint(*id)
+		return &u
+	}
+
+	out := v2_0types.Config{
+		Ignition: v2_0types.Ignition{
+			Version: v2_0types.IgnitionVersion(*semver.New(version)),
+		},
+	}
+	for _, ref := range cfg.Ignition.Config.Append {
+		out.Ignition.Config.Append = append(out.Ignition.Config.Append, translateReference(ref))
+	}
+	if cfg.Ignition.Config.Replace != nil {
+		ref := translateReference(*cfg.Ignition.Config.Replace)
+		out.Ignition.Config.Replace = &ref
+	}
+
+	for _, f := range cfg.Storage.Files {
+		out.Storage.Files = append(out.Storage.Files, v2_0types.File{
+			Filesystem: f.Filesystem,
+			Path:       v2_0types.Path(f.Path),
+			Contents: v2_0types.FileContents{
+				Compression:  v2_0types.Compression(f.Contents.Compression),
+				Source:       translateURL(f.Contents.Source),
+				Verification: translateVerification(f.Contents.Verification),
+			},
+			Mode:  v2_0types.FileMode(f.Mode),
+			User:  v2_0types.FileUser{Id: ownerID(f.Path, f.User.ID, f.User.Name)},
+			Group: v2_0types.FileGroup{Id: ownerID(f.Path, f.Group.ID, f.Group.Name)},
+		})
+	}
+
+	for _, u := range cfg.Systemd.Units {
+		if u.Enabled != nil && !*u.Enabled {
+			legacyUnsupported(version, "disabling units ("+u.Name+")", "2.1.0")
+		}
+		unit := v2_0types.SystemdUnit{
+			Name:     v2_0types.SystemdUnitName(u.Name),
+			Enable:   u.Enable || (u.Enabled != nil && *u.Enabled),
+			Mask:     u.Mask,
+			Contents: u.Contents,
+		}
+		for _, d := range u.Dropins {
+			unit.DropIns = append(unit.DropIns, v2_0types.SystemdUnitDropIn{
+				Name:     v2_0types.SystemdUnitDropInName(d.Name),
+				Contents: d.Contents,
+			})
+		}
+		out.Systemd.Units = append(out.Systemd.Units, unit)
+	}
+	for _, u := range cfg.Networkd.Units {
+		out.Networkd.Units = append(out.Networkd.Units, v2_0types.NetworkdUnit{
+			Name:     v2_0types.NetworkdUnitName(u.Name),
+			Contents: u.Contents,
+		})
+	}
+
+	for _, g := range cfg.Passwd.Groups {
+		out.Passwd.Groups = append(out.Passwd.Groups, v2_0types.Group{
+			Name:         g.Name,
+			Gid:          uid(g.Gid),
+			PasswordHash: g.PasswordHash,
+			System:       g.System,
+		})
+	}
+	for _, u := range cfg.Passwd.Users {
+		if u.Create != nil {
+			legacyUnsupported(version, "passwd user create with spec 2.1 fields ("+u.Name+")", "2.1.0")
+		}
+		user := v2_0types.User{
+			Name: u.Name,
+		}
+		if u.PasswordHash != nil {
+			user.PasswordHash = *u.PasswordHash
+		}
+		for _, k := range u.SSHAuthorizedKeys {
+			user.SSHAuthorizedKeys = append(user.SSHAuthorizedKeys, string(k))
+		}
+		// Spec 2.0 only sets these when creating the user
+		if u.UID != nil || u.Gecos != "" || u.HomeDir != "" || u.NoCreateHome || u.PrimaryGroup != "" ||
+			len(u.Groups) > 0 || u.NoUserGroup || u.System || u.NoLogInit || u.Shell != "" {
+			user.Create = &v2_0types.UserCreate{
+				Uid:          uid(u.UID),
+				GECOS:        u.Gecos,
+				Homedir:      u.HomeDir,
+				NoCreateHome: u.NoCreateHome,
+				PrimaryGroup: u.PrimaryGroup,
+				NoUserGroup:  u.NoUserGroup,
+				System:       u.System,
+				NoLogInit:    u.NoLogInit,
+				Shell:        u.Shell,
+			}
+			for _, g := range u.Groups {
+				user.Create.Groups = append(user.Create.Groups, string(g))
+			}
+		}
+		out.Passwd.Users = append(out.Passwd.Users, user)
+	}
+
+	return out
+}
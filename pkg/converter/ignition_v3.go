@@ -0,0 +1,479 @@
+package converter
+
+import (
+	"log"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+)
+
+// Ignition spec 3 types (https://coreos.github.io/ignition/configuration-v3_2/),
+// only the fields this tool is able to generate. Fields added in 3.1 and 3.2 (proxy,
+// httpHeaders) are only read, to accept the configs the MCO renders, and never set,
+// so the same types render 3.0, 3.1 and 3.2 configs.
+
+type v3Config struct {
+	Ignition v3Ignition `json:"ignition"`
+	Passwd   *v3Passwd  `json:"passwd,omitempty"`
+	Storage  *v3Storage `json:"storage,omitempty"`
+	Systemd  *v3Systemd `json:"systemd,omitempty"`
+}
+
+type v3Ignition struct {
+	Config   *v3IgnitionConfig `json:"config,omitempty"`
+	Proxy    *v3Proxy          `json:"proxy,omitempty"`
+	Security *v3Security       `json:"security,omitempty"`
+	Timeouts *v3Timeouts       `json:"timeouts,omitempty"`
+	Version  string            `json:"version"`
+}
+
+type v3IgnitionConfig struct {
+	Merge   []v3Resource `json:"merge,omitempty"`
+	Replace *v3Resource  `json:"replace,omitempty"`
+}
+
+type v3Proxy struct {
+	HTTPProxy  *string  `json:"httpProxy,omitempty"`
+	HTTPSProxy *string  `json:"httpsProxy,omitempty"`
+	NoProxy    []string `json:"noProxy,omitempty"`
+}
+
+type v3Security struct {
+	TLS v3TLS `json:"tls"`
+}
+
+type v3TLS struct {
+	CertificateAuthorities []v3Resource `json:"certificateAuthorities,omitempty"`
+}
+
+type v3Timeouts struct {
+	HTTPResponseHeaders *int `json:"httpResponseHeaders,omitempty"`
+	HTTPTotal           *int `json:"httpTotal,omitempty"`
+}
+
+type v3Resource struct {
+	Compression  string         `json:"compression,omitempty"`
+	HTTPHeaders  []v3HTTPHeader `json:"httpHeaders,omitempty"`
+	Source       *string        `json:"source,omitempty"`
+	Verification v3Verification `json:"verification,omitempty"`
+}
+
+type v3HTTPHeader struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value,omitempty"`
+}
+
+type v3Verification struct {
+	Hash *string `json:"hash,omitempty"`
+}
+
+type v3Passwd struct {
+	Groups []v3PasswdGroup `json:"groups,omitempty"`
+	Users  []v3PasswdUser  `json:"users,omitempty"`
+}
+
+type v3PasswdGroup struct {
+	Gid          *int   `json:"gid,omitempty"`
+	Name         string `json:"name"`
+	PasswordHash string `json:"passwordHash,omitempty"`
+	System       bool   `json:"system,omitempty"`
+}
+
+type v3PasswdUser struct {
+	Gecos             string   `json:"gecos,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+	HomeDir           string   `json:"homeDir,omitempty"`
+	Name              string   `json:"name"`
+	NoCreateHome      bool     `json:"noCreateHome,omitempty"`
+	NoLogInit         bool     `json:"noLogInit,omitempty"`
+	NoUserGroup       bool     `json:"noUserGroup,omitempty"`
+	PasswordHash      *string  `json:"passwordHash,omitempty"`
+	PrimaryGroup      string   `json:"primaryGroup,omitempty"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+	Shell             string   `json:"shell,omitempty"`
+	System            bool     `json:"system,omitempty"`
+	UID               *int     `json:"uid,omitempty"`
+}
+
+type v3Storage struct {
+	Directories []v3Directory `json:"directories,omitempty"`
+	Files       []v3File      `json:"files,omitempty"`
+	Links       []v3Link      `json:"links,omitempty"`
+}
+
+type v3Node struct {
+	Group     *v3NodeOwner `json:"group,omitempty"`
+	Overwrite *bool        `json:"overwrite,omitempty"`
+	Path      string       `json:"path"`
+	User      *v3NodeOwner `json:"user,omitempty"`
+}
+
+type v3NodeOwner struct {
+	ID   *int   `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type v3Directory struct {
+	v3Node
+	Mode *int `json:"mode,omitempty"`
+}
+
+type v3File struct {
+	v3Node
+	Append   []v3Resource `json:"append,omitempty"`
+	Contents *v3Resource  `json:"contents,omitempty"`
+	Mode     *int         `json:"mode,omitempty"`
+}
+
+type v3Link struct {
+	v3Node
+	Hard   bool   `json:"hard,omitempty"`
+	Target string `json:"target"`
+}
+
+type v3Systemd struct {
+	Units []v3Unit `json:"units,omitempty"`
+}
+
+type v3Unit struct {
+	Contents string     `json:"contents,omitempty"`
+	Dropins  []v3Dropin `json:"dropins,omitempty"`
+	Enabled  *bool      `json:"enabled,omitempty"`
+	Mask     bool       `json:"mask,omitempty"`
+	Name     string     `json:"name"`
+}
+
+type v3Dropin struct {
+	Contents string `json:"contents,omitempty"`
+	Name     string `json:"name"`
+}
+
+// translateV3Node Spec 3 has no filesystem field, nodes are always written to the root filesystem.
+// Spec 2 overwrites files by default, spec 3 doesn't, so keep the spec 2 behaviour.
+func translateV3Node(node igntypes.Node, overwrite bool) v3Node {
+	if node.Filesystem != "" && node.Filesystem != defaultFilesystem {
+		log.Fatalf("%s uses filesystem %s, Ignition 3 only supports the root filesystem", node.Path, node.Filesystem)
+	}
+	out := v3Node{
+		Path: node.Path,
+	}
+	switch {
+	case node.Overwrite != nil:
+		out.Overwrite = node.Overwrite
+	case overwrite:
+		out.Overwrite = &overwrite
+	}
+	if node.User != nil {
+		out.User = &v3NodeOwner{ID: node.User.ID, Name: node.User.Name}
+	}
+	if node.Group != nil {
+		out.Group = &v3NodeOwner{ID: node.Group.ID, Name: node.Group.Name}
+	}
+	return out
+}
+
+// translateV3Resource Converts a spec 2 source/verification pair
+func translateV3Resource(compression string, source string, verification igntypes.Verification) v3Resource {
+	return v3Resource{
+		Compression:  compression,
+		Source:       &source,
+		Verification: v3Verification{Hash: verification.Hash},
+	}
+}
+
+// translateToV3 Converts the spec 2.2 config built by NewMachineConfig to spec 3
+func translateToV3(cfg igntypes.Config, version string) v3Config {
+	if len(cfg.Networkd.Units) > 0 {
+		log.Fatalf("networkd units are not supported by Ignition 3")
+	}
+	if len(cfg.Storage.Disks) > 0 || len(cfg.Storage.Raid) > 0 || len(cfg.Storage.Filesystems) > 0 {
+		log.Fatalf("disks, raid and filesystems can't be translated to Ignition 3")
+	}
+
+	out := v3Config{
+		Ignition: v3Ignition{
+			Version: version,
+		},
+	}
+
+	// Spec 3 merges the configs spec 2 appends
+	if len(cfg.Ignition.Config.Append) > 0 || cfg.Ignition.Config.Replace != nil {
+		out.Ignition.Config = &v3IgnitionConfig{}
+		for _, ref := range cfg.Ignition.Config.Append {
+			out.Ignition.Config.Merge = append(out.Ignition.Config.Merge, translateV3Resource("", ref.Source, ref.Verification))
+		}
+		if cfg.Ignition.Config.Replace != nil {
+			replace := translateV3Resource("", cfg.Ignition.Config.Replace.Source, cfg.Ignition.Config.Replace.Verification)
+			out.Ignition.Config.Replace = &replace
+		}
+	}
+
+	if len(cfg.Ignition.Security.TLS.CertificateAuthorities) > 0 {
+		out.Ignition.Security = &v3Security{}
+		for _, ca := range cfg.Ignition.Security.TLS.CertificateAuthorities {
+			out.Ignition.Security.TLS.CertificateAuthorities = append(out.Ignition.Security.TLS.CertificateAuthorities,
+				translateV3Resource("", ca.Source, ca.Verification))
+		}
+	}
+	if cfg.Ignition.Timeouts.HTTPResponseHeaders != nil || cfg.Ignition.Timeouts.HTTPTotal != nil {
+		out.Ignition.Timeouts = &v3Timeouts{
+			HTTPResponseHeaders: cfg.Ignition.Timeouts.HTTPResponseHeaders,
+			HTTPTotal:           cfg.Ignition.Timeouts.HTTPTotal,
+		}
+	}
+
+	if len(cfg.Passwd.Users) > 0 || len(cfg.Passwd.Groups) > 0 {
+		out.Passwd = &v3Passwd{}
+		for _, g := range cfg.Passwd.Groups {
+			out.Passwd.Groups = append(out.Passwd.Groups, v3PasswdGroup{
+				Gid:          g.Gid,
+				Name:         g.Name,
+				PasswordHash: g.PasswordHash,
+				System:       g.System,
+			})
+		}
+		for _, u := range cfg.Passwd.Users {
+			if u.Create != nil {
+				log.Fatalf("passwd user %s uses create, which doesn't exist in Ignition 3", u.Name)
+			}
+			user := v3PasswdUser{
+				Gecos:        u.Gecos,
+				HomeDir:      u.HomeDir,
+				Name:         u.Name,
+				NoCreateHome: u.NoCreateHome,
+				NoLogInit:    u.NoLogInit,
+				NoUserGroup:  u.NoUserGroup,
+				PasswordHash: u.PasswordHash,
+				PrimaryGroup: u.PrimaryGroup,
+				Shell:        u.Shell,
+				System:       u.System,
+				UID:          u.UID,
+			}
+			for _, g := range u.Groups {
+				user.Groups = append(user.Groups, string(g))
+			}
+			for _, k := range u.SSHAuthorizedKeys {
+				user.SSHAuthorizedKeys = append(user.SSHAuthorizedKeys, string(k))
+			}
+			out.Passwd.Users = append(out.Passwd.Users, user)
+		}
+	}
+
+	if len(cfg.Storage.Files) > 0 || len(cfg.Storage.Directories) > 0 || len(cfg.Storage.Links) > 0 {
+		out.Storage = &v3Storage{}
+		for _, d := range cfg.Storage.Directories {
+			out.Storage.Directories = append(out.Storage.Directories, v3Directory{
+				v3Node: translateV3Node(d.Node, false),
+				Mode:   d.Mode,
+			})
+		}
+		for _, f := range cfg.Storage.Files {
+			file := v3File{
+				v3Node: translateV3Node(f.Node, !f.Append),
+				Mode:   f.Mode,
+			}
+			contents := translateV3Resource(f.Contents.Compression, f.Contents.Source, f.Contents.Verification)
+			if f.Append {
+				file.Append = []v3Resource{contents}
+			} else {
+				file.Contents = &contents
+			}
+			out.Storage.Files = append(out.Storage.Files, file)
+		}
+		for _, l := range cfg.Storage.Links {
+			out.Storage.Links = append(out.Storage.Links, v3Link{
+				v3Node: translateV3Node(l.Node, true),
+				Hard:   l.Hard,
+				Target: l.Target,
+			})
+		}
+	}
+
+	if len(cfg.Systemd.Units) > 0 {
+		out.Systemd = &v3Systemd{}
+		for _, u := range cfg.Systemd.Units {
+			unit := v3Unit{
+				Contents: u.Contents,
+				Enabled:  u.Enabled,
+				Mask:     u.Mask,
+				Name:     u.Name,
+			}
+			// enable is deprecated in spec 2 and gone in spec 3
+			if u.Enable && u.Enabled == nil {
+				enabled := true
+				unit.Enabled = &enabled
+			}
+			for _, d := range u.Dropins {
+				unit.Dropins = append(unit.Dropins, v3Dropin{
+					Contents: d.Contents,
+					Name:     d.Name,
+				})
+			}
+			out.Systemd.Units = append(out.Systemd.Units, unit)
+		}
+	}
+
+	return out
+}
+
+// translateFromV3Node Converts a spec 3 node, always written to the root filesystem.
+// Spec 3 doesn't overwrite by default, the spec 2 default only applies to generated nodes.
+func translateFromV3Node(node v3Node) igntypes.Node {
+	overwrite := false
+	if node.Overwrite != nil {
+		overwrite = *node.Overwrite
+	}
+	out := igntypes.Node{
+		Filesystem: defaultFilesystem,
+		Overwrite:  &overwrite,
+		Path:       node.Path,
+	}
+	if node.User != nil {
+		out.User = &igntypes.NodeUser{ID: node.User.ID, Name: node.User.Name}
+	}
+	if node.Group != nil {
+		out.Group = &igntypes.NodeGroup{ID: node.Group.ID, Name: node.Group.Name}
+	}
+	return out
+}
+
+// translateFromV3Resource Converts a spec 3 resource to a spec 2 source/verification pair
+func translateFromV3Resource(resource v3Resource) (string, igntypes.Verification) {
+	source := ""
+	if resource.Source != nil {
+		source = *resource.Source
+	}
+	if len(resource.HTTPHeaders) > 0 {
+		log.Fatalf("%s uses httpHeaders, they can't be translated to Ignition 2", source)
+	}
+	return source, igntypes.Verification{Hash: resource.Verification.Hash}
+}
+
+// translateFromV3Reference Converts a spec 3 config resource, compression doesn't exist for spec 2 configs
+func translateFromV3Reference(resource v3Resource) igntypes.ConfigReference {
+	source, verification := translateFromV3Resource(resource)
+	if resource.Compression != "" {
+		log.Fatalf("config %s is compressed, it can't be translated to Ignition 2", source)
+	}
+	return igntypes.ConfigReference{Source: source, Verification: verification}
+}
+
+// translateFromV3 Converts a spec 3 config to spec 2.2, the inverse of translateToV3
+func translateFromV3(in v3Config) igntypes.Config {
+	out := igntypes.Config{
+		Ignition: igntypes.Ignition{
+			Version: in.Ignition.Version,
+		},
+	}
+
+	// The MCO renders an empty replace and proxy
+	if in.Ignition.Config != nil {
+		for _, ref := range in.Ignition.Config.Merge {
+			out.Ignition.Config.Append = append(out.Ignition.Config.Append, translateFromV3Reference(ref))
+		}
+		if replace := in.Ignition.Config.Replace; replace != nil && (replace.Source != nil || replace.Verification.Hash != nil) {
+			ref := translateFromV3Reference(*replace)
+			out.Ignition.Config.Replace = &ref
+		}
+	}
+	if in.Ignition.Proxy != nil && (in.Ignition.Proxy.HTTPProxy != nil || in.Ignition.Proxy.HTTPSProxy != nil || len(in.Ignition.Proxy.NoProxy) > 0) {
+		log.Fatalf("ignition.proxy can't be translated to Ignition 2")
+	}
+	if in.Ignition.Security != nil {
+		for _, ca := range in.Ignition.Security.TLS.CertificateAuthorities {
+			source, verification := translateFromV3Resource(ca)
+			out.Ignition.Security.TLS.CertificateAuthorities = append(out.Ignition.Security.TLS.CertificateAuthorities,
+				igntypes.CaReference{Source: source, Verification: verification})
+		}
+	}
+	if in.Ignition.Timeouts != nil {
+		out.Ignition.Timeouts = igntypes.Timeouts{
+			HTTPResponseHeaders: in.Ignition.Timeouts.HTTPResponseHeaders,
+			HTTPTotal:           in.Ignition.Timeouts.HTTPTotal,
+		}
+	}
+
+	if in.Passwd != nil {
+		for _, g := range in.Passwd.Groups {
+			out.Passwd.Groups = append(out.Passwd.Groups, igntypes.PasswdGroup{
+				Gid:          g.Gid,
+				Name:         g.Name,
+				PasswordHash: g.PasswordHash,
+				System:       g.System,
+			})
+		}
+		for _, u := range in.Passwd.Users {
+			user := igntypes.PasswdUser{
+				Gecos:        u.Gecos,
+				HomeDir:      u.HomeDir,
+				Name:         u.Name,
+				NoCreateHome: u.NoCreateHome,
+				NoLogInit:    u.NoLogInit,
+				NoUserGroup:  u.NoUserGroup,
+				PasswordHash: u.PasswordHash,
+				PrimaryGroup: u.PrimaryGroup,
+				Shell:        u.Shell,
+				System:       u.System,
+				UID:          u.UID,
+			}
+			for _, g := range u.Groups {
+				user.Groups = append(user.Groups, igntypes.Group(g))
+			}
+			for _, k := range u.SSHAuthorizedKeys {
+				user.SSHAuthorizedKeys = append(user.SSHAuthorizedKeys, igntypes.SSHAuthorizedKey(k))
+			}
+			out.Passwd.Users = append(out.Passwd.Users, user)
+		}
+	}
+
+	if in.Storage != nil {
+		for _, d := range in.Storage.Directories {
+			out.Storage.Directories = append(out.Storage.Directories, igntypes.Directory{
+				Node:               translateFromV3Node(d.v3Node),
+				DirectoryEmbedded1: igntypes.DirectoryEmbedded1{Mode: d.Mode},
+			})
+		}
+		for _, f := range in.Storage.Files {
+			file := igntypes.File{
+				Node:          translateFromV3Node(f.v3Node),
+				FileEmbedded1: igntypes.FileEmbedded1{Mode: f.Mode},
+			}
+			contents := f.Contents
+			if len(f.Append) > 0 {
+				// Spec 2 appends a single resource
+				if len(f.Append) > 1 || f.Contents != nil {
+					log.Fatalf("%s appends more than one resource, it can't be translated to Ignition 2", f.Path)
+				}
+				file.Append = true
+				contents = &f.Append[0]
+			}
+			if contents != nil {
+				file.Contents.Compression = contents.Compression
+				file.Contents.Source, file.Contents.Verification = translateFromV3Resource(*contents)
+			}
+			out.Storage.Files = append(out.Storage.Files, file)
+		}
+		for _, l := range in.Storage.Links {
+			out.Storage.Links = append(out.Storage.Links, igntypes.Link{
+				Node:          translateFromV3Node(l.v3Node),
+				LinkEmbedded1: igntypes.LinkEmbedded1{Hard: l.Hard, Target: l.Target},
+			})
+		}
+	}
+
+	if in.Systemd != nil {
+		for _, u := range in.Systemd.Units {
+			unit := igntypes.Unit{
+				Contents: u.Contents,
+				Enabled:  u.Enabled,
+				Mask:     u.Mask,
+				Name:     u.Name,
+			}
+			for _, d := range u.Dropins {
+				unit.Dropins = append(unit.Dropins, igntypes.SystemdDropin{Contents: d.Contents, Name: d.Name})
+			}
+			out.Systemd.Units = append(out.Systemd.Units, unit)
+		}
+	}
+
+	return out
+}
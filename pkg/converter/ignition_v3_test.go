@@ -0,0 +1,111 @@
+package converter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+)
+
+// A config as the MCO renders it, with the empty replace and proxy of spec 3.1/3.2
+var v3RoundTripConfig = `{
+  "ignition": {
+    "config": {
+      "merge": [{"source": "https://example.com/base.ign", "verification": {"hash": "sha512-00"}}],
+      "replace": {"verification": {}}
+    },
+    "proxy": {},
+    "security": {"tls": {"certificateAuthorities": [{"source": "data:,ca"}]}},
+    "timeouts": {"httpTotal": 30},
+    "version": "3.2.0"
+  },
+  "passwd": {
+    "groups": [{"name": "app", "gid": 1500}],
+    "users": [
+      {"name": "core", "sshAuthorizedKeys": ["ssh-ed25519 AAAA"]},
+      {"name": "app", "uid": 1500, "groups": ["wheel"], "shell": "/sbin/nologin"}
+    ]
+  },
+  "storage": {
+    "directories": [{"path": "/etc/app", "mode": 493}],
+    "files": [
+      {"path": "/etc/app/app.conf", "contents": {"source": "data:,a", "verification": {}}, "mode": 420, "overwrite": true, "user": {"name": "app"}},
+      {"path": "/etc/other", "contents": {"source": "data:,b"}},
+      {"path": "/etc/log", "append": [{"source": "data:,c", "compression": "gzip"}], "group": {"id": 10}}
+    ],
+    "links": [{"path": "/etc/link", "target": "/etc/other"}]
+  },
+  "systemd": {
+    "units": [
+      {"name": "app.service", "enabled": true, "contents": "[Unit]\n", "dropins": [{"name": "10-env.conf", "contents": "[Service]\n"}]},
+      {"name": "bad.service", "mask": true}
+    ]
+  }
+}`
+
+func TestV3RoundTrip(t *testing.T) {
+	cfg, err := parseConfig([]byte(v3RoundTripConfig))
+	if err != nil {
+		t.Fatalf("parseConfig() failed: %s", err)
+	}
+
+	out := translateToV3(cfg, cfg.Ignition.Version)
+	raw, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := parseConfig(raw)
+	if err != nil {
+		t.Fatalf("parseConfig() of the translated config failed: %s", err)
+	}
+	if !reflect.DeepEqual(cfg, again) {
+		t.Errorf("v3 -> v2.2 -> v3 changed the config:\n%s\nbecame\n%s", jsonString(cfg), jsonString(again))
+	}
+
+	// Nodes without overwrite must not start overwriting
+	for _, f := range out.Storage.Files {
+		want := f.Path == "/etc/app/app.conf"
+		if f.Overwrite == nil || *f.Overwrite != want {
+			t.Errorf("overwrite of %s = %s, want %v", f.Path, jsonString(f.Overwrite), want)
+		}
+	}
+	if l := out.Storage.Links[0]; l.Overwrite != nil && *l.Overwrite {
+		t.Errorf("overwrite of %s = true, want false", l.Path)
+	}
+	if out.Ignition.Config.Replace != nil {
+		t.Errorf("empty replace translated to %s", jsonString(out.Ignition.Config.Replace))
+	}
+}
+
+func TestTranslateToV3Defaults(t *testing.T) {
+	cfg := igntypes.Config{Ignition: igntypes.Ignition{Version: defaultIgnitionVersion}}
+	cfg.Storage.Files = []igntypes.File{
+		{Node: igntypes.Node{Filesystem: "root", Path: "/etc/new"}},
+		{Node: igntypes.Node{Filesystem: "root", Path: "/etc/log"}, FileEmbedded1: igntypes.FileEmbedded1{Append: true}},
+	}
+	cfg.Storage.Directories = []igntypes.Directory{{Node: igntypes.Node{Filesystem: "root", Path: "/etc/new.d"}}}
+	cfg.Storage.Links = []igntypes.Link{{Node: igntypes.Node{Filesystem: "root", Path: "/etc/link"}, LinkEmbedded1: igntypes.LinkEmbedded1{Target: "/etc/new"}}}
+
+	out := translateToV3(cfg, "3.2.0")
+	tests := []struct {
+		path string
+		got  *bool
+		want *bool
+	}{
+		// Spec 2 overwrites files and links by default
+		{"/etc/new", out.Storage.Files[0].Overwrite, boolPointer(true)},
+		{"/etc/log", out.Storage.Files[1].Overwrite, nil},
+		{"/etc/new.d", out.Storage.Directories[0].Overwrite, nil},
+		{"/etc/link", out.Storage.Links[0].Overwrite, boolPointer(true)},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("overwrite of %s = %s, want %s", tt.path, jsonString(tt.got), jsonString(tt.want))
+		}
+	}
+}
+
+func boolPointer(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,155 @@
+package converter
+
+import (
+	"log"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+	MachineConfig "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// loadInto Take the defaults from the MachineConfig the new content is merged into
+func loadInto(rawdata *Parameters) {
+	// The existing object is updated, it can't be renamed or relabeled
+	if rawdata.Name != "" {
+		log.Fatalf("--name can't be used with --into, the name of %s is kept", rawdata.Into)
+	}
+	if rawdata.Labels != "" {
+		log.Fatalf("--labels can't be used with --into, the labels of %s are kept", rawdata.Into)
+	}
+	existing := LoadMachineConfig(rawdata.Into)
+	rawdata.Name = existing.Name
+	rawdata.Labels = labelsString(existing.Labels)
+	if rawdata.IgnitionVer == "" {
+		rawdata.IgnitionVer = existing.Spec.Config.Ignition.Version
+	}
+	if rawdata.APIVer == "" {
+		rawdata.APIVer = existing.APIVersion
+	}
+}
+
+// removeNodePath Drops every file, directory and link using a path, the new node replaces them
+func removeNodePath(cfg *igntypes.Config, remote string) {
+	var directories []igntypes.Directory
+	for _, d := range cfg.Storage.Directories {
+		if d.Path != remote {
+			directories = append(directories, d)
+		}
+	}
+	cfg.Storage.Directories = directories
+	var links []igntypes.Link
+	for _, l := range cfg.Storage.Links {
+		if l.Path != remote {
+			links = append(links, l)
+		}
+	}
+	cfg.Storage.Links = links
+	var files []igntypes.File
+	for _, f := range cfg.Storage.Files {
+		if f.Path != remote {
+			files = append(files, f)
+		}
+	}
+	cfg.Storage.Files = files
+}
+
+// clearServerFields Drops the metadata the API server sets, e.g. when the MachineConfig comes from oc get -o yaml.
+// managedFields and status are not part of the vendored types and are dropped when loading it.
+func clearServerFields(meta *metav1.ObjectMeta) {
+	meta.ResourceVersion = ""
+	meta.UID = ""
+	meta.SelfLink = ""
+	meta.Generation = 0
+	meta.CreationTimestamp = metav1.Time{}
+}
+
+// mergeInto Appends the new nodes to an existing MachineConfig, replacing the ones with the same path (or name).
+// The name, labels, annotations and the spec fields other than config of the existing MachineConfig are kept.
+func mergeInto(existing MachineConfigObject, mc MachineConfig.MachineConfig) MachineConfigObject {
+	clearServerFields(&existing.ObjectMeta)
+	cfg := existing.Spec.Config
+	add := mc.Spec.Config
+
+	for _, f := range add.Storage.Files {
+		replaced := false
+		for i := range cfg.Storage.Files {
+			if cfg.Storage.Files[i].Path == f.Path {
+				cfg.Storage.Files[i] = f
+				replaced = true
+			}
+		}
+		if replaced {
+			log.Printf("replacing '%s' in %s", f.Path, existing.Name)
+			continue
+		}
+		log.Printf("adding '%s' to %s", f.Path, existing.Name)
+		removeNodePath(&cfg, f.Path)
+		cfg.Storage.Files = append(cfg.Storage.Files, f)
+	}
+	for _, d := range add.Storage.Directories {
+		log.Printf("setting directory '%s' in %s", d.Path, existing.Name)
+		removeNodePath(&cfg, d.Path)
+		cfg.Storage.Directories = append(cfg.Storage.Directories, d)
+	}
+	for _, l := range add.Storage.Links {
+		log.Printf("setting link '%s' in %s", l.Path, existing.Name)
+		removeNodePath(&cfg, l.Path)
+		cfg.Storage.Links = append(cfg.Storage.Links, l)
+	}
+
+	for _, u := range add.Systemd.Units {
+		if i := findUnitIn(cfg.Systemd.Units, u.Name); i >= 0 {
+			log.Printf("replacing unit '%s' in %s", u.Name, existing.Name)
+			cfg.Systemd.Units[i] = u
+			continue
+		}
+		log.Printf("adding unit '%s' to %s", u.Name, existing.Name)
+		cfg.Systemd.Units = append(cfg.Systemd.Units, u)
+	}
+
+	for _, u := range add.Passwd.Users {
+		if i := findPasswdUser(cfg.Passwd.Users, u.Name); i >= 0 {
+			cfg.Passwd.Users[i] = u
+			continue
+		}
+		cfg.Passwd.Users = append(cfg.Passwd.Users, u)
+	}
+	for _, g := range add.Passwd.Groups {
+		if i := findPasswdGroup(cfg.Passwd.Groups, g.Name); i >= 0 {
+			cfg.Passwd.Groups[i] = g
+			continue
+		}
+		cfg.Passwd.Groups = append(cfg.Passwd.Groups, g)
+	}
+
+	for _, ca := range add.Ignition.Security.TLS.CertificateAuthorities {
+		found := false
+		for _, existingca := range cfg.Ignition.Security.TLS.CertificateAuthorities {
+			found = found || existingca.Source == ca.Source
+		}
+		if !found {
+			cfg.Ignition.Security.TLS.CertificateAuthorities = append(cfg.Ignition.Security.TLS.CertificateAuthorities, ca)
+		}
+	}
+	if add.Ignition.Timeouts.HTTPResponseHeaders != nil {
+		cfg.Ignition.Timeouts.HTTPResponseHeaders = add.Ignition.Timeouts.HTTPResponseHeaders
+	}
+	if add.Ignition.Timeouts.HTTPTotal != nil {
+		cfg.Ignition.Timeouts.HTTPTotal = add.Ignition.Timeouts.HTTPTotal
+	}
+
+	// The existing version is used unless a different one is requested
+	cfg.Ignition.Version = add.Ignition.Version
+	existing.Spec.Config = cfg
+	return existing
+}
+
+// findUnitIn Returns the index of the named unit, -1 if it doesn't exist
+func findUnitIn(units []igntypes.Unit, name string) int {
+	for i := range units {
+		if units[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,18 @@
+// +build !windows
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// hardLinkID Returns an identifier shared by all the hard links of a file, empty if it only has one
+func hardLinkID(file os.FileInfo) string {
+	stat, ok := file.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+}
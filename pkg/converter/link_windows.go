@@ -0,0 +1,12 @@
+// +build windows
+
+package converter
+
+import (
+	"os"
+)
+
+// hardLinkID Hard links are not detected on Windows
+func hardLinkID(file os.FileInfo) string {
+	return ""
+}
@@ -0,0 +1,167 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+	MachineConfig "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+)
+
+// LintIssue A node written by more than one MachineConfig of a pool
+type LintIssue struct {
+	Pool string
+	Node string
+	// MachineConfigs writing the node in merge order, the last one wins
+	MachineConfigs []string
+	// What isn't the same between them (contents, mode...), empty if they write the same node
+	Differences []string
+}
+
+// String Describes the issue in a line
+func (i LintIssue) String() string {
+	result := "identical"
+	if len(i.Differences) > 0 {
+		result = "different " + strings.Join(i.Differences, ", ")
+	}
+	return fmt.Sprintf("%s: %s written by %s, %s wins (%s)", i.Pool, i.Node, strings.Join(i.MachineConfigs, ", "), i.MachineConfigs[len(i.MachineConfigs)-1], result)
+}
+
+// jsonString Returns the JSON form of a value, to compare nodes
+func jsonString(value interface{}) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(b)
+}
+
+// nodeAspects Returns what a MachineConfig writes for a node, keyed as RenderedPool.Origins
+func nodeAspects(cfg igntypes.Config, node string) map[string]string {
+	aspects := make(map[string]string)
+	switch {
+	case strings.HasPrefix(node, "unit "):
+		if i := findUnitIn(cfg.Systemd.Units, strings.TrimPrefix(node, "unit ")); i >= 0 {
+			u := cfg.Systemd.Units[i]
+			// Units are merged, units without contents keep the previous ones
+			if u.Contents != "" {
+				aspects["contents"] = u.Contents
+			}
+			aspects["state"] = jsonString([]interface{}{u.Enabled, u.Enable, u.Mask})
+		}
+	case strings.HasPrefix(node, "dropin "):
+		parts := strings.SplitN(strings.TrimPrefix(node, "dropin "), "/", 2)
+		if i := findUnitIn(cfg.Systemd.Units, parts[0]); i >= 0 {
+			for _, d := range cfg.Systemd.Units[i].Dropins {
+				if d.Name == parts[1] {
+					aspects["contents"] = d.Contents
+				}
+			}
+		}
+	case strings.HasPrefix(node, "user "):
+		if i := findPasswdUser(cfg.Passwd.Users, strings.TrimPrefix(node, "user ")); i >= 0 {
+			aspects["settings"] = jsonString(cfg.Passwd.Users[i])
+		}
+	case strings.HasPrefix(node, "group "):
+		if i := findPasswdGroup(cfg.Passwd.Groups, strings.TrimPrefix(node, "group ")); i >= 0 {
+			aspects["settings"] = jsonString(cfg.Passwd.Groups[i])
+		}
+	default:
+		// The last node written for the path is the one that counts
+		for _, f := range cfg.Storage.Files {
+			if f.Path == node {
+				aspects = map[string]string{
+					"type":     "file",
+					"contents": describeContents(f.Contents),
+					"mode":     fmt.Sprintf("%#o", nodeMode(f.Mode, defaultFileMode)),
+					"owner":    nodeOwner(f.Node),
+					"append":   fmt.Sprint(f.Append),
+				}
+			}
+		}
+		for _, d := range cfg.Storage.Directories {
+			if d.Path == node {
+				aspects = map[string]string{
+					"type":  "directory",
+					"mode":  fmt.Sprintf("%#o", nodeMode(d.Mode, defaultDirectoryMode)),
+					"owner": nodeOwner(d.Node),
+				}
+			}
+		}
+		for _, l := range cfg.Storage.Links {
+			if l.Path == node {
+				aspects = map[string]string{
+					"type":   "link",
+					"target": l.Target,
+					"hard":   fmt.Sprint(l.Hard),
+					"owner":  nodeOwner(l.Node),
+				}
+			}
+		}
+	}
+	return aspects
+}
+
+// poolNames Returns the pools of a directory: the roles of its MachineConfigs and its MachineConfigPools
+func poolNames(mcs []MachineConfigObject, pools []MachineConfig.MachineConfigPool) []string {
+	var names []string
+	for _, mc := range mcs {
+		role, ok := mc.Labels[roleLabel]
+		if !ok {
+			log.Printf("MachineConfig %s doesn't have the %s label, no pool selects it", mc.Name, roleLabel)
+			continue
+		}
+		if !stringInList(role, names) {
+			names = append(names, role)
+		}
+	}
+	for _, p := range pools {
+		if !stringInList(p.Name, names) {
+			names = append(names, p.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LintDirectory Returns the nodes written by more than one MachineConfig of the same pool
+func LintDirectory(mcs []MachineConfigObject, pools []MachineConfig.MachineConfigPool) []LintIssue {
+	configs := make(map[string]igntypes.Config)
+	for _, mc := range mcs {
+		configs[mc.Name] = mc.Spec.Config
+	}
+
+	var issues []LintIssue
+	for _, pool := range poolNames(mcs, pools) {
+		if len(SelectMachineConfigs(pool, mcs, pools)) == 0 {
+			continue
+		}
+		rendered := RenderPool(pool, mcs, pools)
+
+		var nodes []string
+		for node, origins := range rendered.Origins {
+			if len(origins) > 1 {
+				nodes = append(nodes, node)
+			}
+		}
+		sort.Strings(nodes)
+
+		for _, node := range nodes {
+			issue := LintIssue{Pool: pool, Node: node, MachineConfigs: rendered.Origins[node]}
+			first := nodeAspects(configs[issue.MachineConfigs[0]], node)
+			for _, name := range issue.MachineConfigs[1:] {
+				for aspect, value := range nodeAspects(configs[name], node) {
+					if first[aspect] != value && !stringInList(aspect, issue.Differences) {
+						issue.Differences = append(issue.Differences, aspect)
+					}
+				}
+			}
+			sort.Strings(issue.Differences)
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,126 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	ignv2_2 "github.com/coreos/ignition/config/v2_2"
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+	MachineConfig "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+)
+
+// parseConfig Creates a spec 2.2 config from any supported ignition version, keeping the original version
+func parseConfig(raw []byte) (igntypes.Config, error) {
+	var header struct {
+		Ignition struct {
+			Version string `json:"version"`
+		} `json:"ignition"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return igntypes.Config{}, err
+	}
+	version := header.Ignition.Version
+
+	// Fields this tool doesn't know would be silently lost
+	if strings.HasPrefix(version, "3.") {
+		var cfg v3Config
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg); err != nil {
+			return igntypes.Config{}, err
+		}
+		return translateFromV3(cfg), nil
+	}
+
+	// Older versions are translated to 2.2 by the ignition parser
+	cfg, _, err := ignv2_2.Parse(raw)
+	if err != nil {
+		return igntypes.Config{}, err
+	}
+	cfg.Ignition.Version = version
+	return cfg, nil
+}
+
+// MachineConfigObject A MachineConfig and the spec fields of newer MCO versions the vendored types don't have
+// (kernelArguments, fips, extensions, kernelType...), kept as they are so they are never lost
+type MachineConfigObject struct {
+	MachineConfig.MachineConfig
+
+	// Every spec field but osImageURL and config
+	SpecFields map[string]json.RawMessage
+}
+
+// specFieldNames Returns the names of the spec fields the vendored types don't have, sorted
+func specFieldNames(mc MachineConfigObject) []string {
+	var names []string
+	for name := range mc.SpecFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodeMachineConfig Creates a MachineConfig from its JSON form, whatever ignition version it uses
+func decodeMachineConfig(jsoncontent []byte) (MachineConfigObject, error) {
+	var raw machineConfigRaw
+	if err := json.Unmarshal(jsoncontent, &raw); err != nil {
+		return MachineConfigObject{}, err
+	}
+	var fields struct {
+		Spec map[string]json.RawMessage `json:"spec"`
+	}
+	if err := json.Unmarshal(jsoncontent, &fields); err != nil {
+		return MachineConfigObject{}, err
+	}
+	if raw.Kind != "MachineConfig" {
+		return MachineConfigObject{}, fmt.Errorf("not a MachineConfig (kind %s)", raw.Kind)
+	}
+
+	mc := MachineConfigObject{
+		MachineConfig: MachineConfig.MachineConfig{
+			TypeMeta:   raw.TypeMeta,
+			ObjectMeta: raw.ObjectMeta,
+			Spec: MachineConfig.MachineConfigSpec{
+				OSImageURL: raw.Spec.OSImageURL,
+			},
+		},
+	}
+	delete(fields.Spec, "osImageURL")
+	delete(fields.Spec, "config")
+	if len(fields.Spec) > 0 {
+		mc.SpecFields = fields.Spec
+	}
+	// An empty config is valid, e.g. MachineConfigs only setting the OS image
+	if len(raw.Spec.Config.Raw) > 0 && string(raw.Spec.Config.Raw) != "null" && string(raw.Spec.Config.Raw) != "{}" {
+		cfg, err := parseConfig(raw.Spec.Config.Raw)
+		if err != nil {
+			return MachineConfigObject{}, fmt.Errorf("invalid config: %s", err)
+		}
+		mc.Spec.Config = cfg
+	}
+	return mc, nil
+}
+
+// LoadMachineConfig Creates a MachineConfig from a YAML or JSON file, whatever ignition version it uses
+func LoadMachineConfig(file string) MachineConfigObject {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	jsoncontent, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		log.Fatalf("Invalid MachineConfig %s: %s", file, err)
+	}
+	mc, err := decodeMachineConfig(jsoncontent)
+	if err != nil {
+		log.Fatalf("Invalid MachineConfig %s: %s", file, err)
+	}
+	return mc
+}
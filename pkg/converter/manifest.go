@@ -0,0 +1,383 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Manifest Struct describing a whole MachineConfig (YAML or JSON)
+type Manifest struct {
+	Name         string              `json:"name,omitempty"`
+	Roles        []string            `json:"roles,omitempty"`
+	Labels       map[string]string   `json:"labels,omitempty"`
+	User         string              `json:"user,omitempty"`
+	Group        string              `json:"group,omitempty"`
+	UID          *int                `json:"uid,omitempty"`
+	GID          *int                `json:"gid,omitempty"`
+	OwnerMap     string              `json:"ownerMap,omitempty"`
+	NumericIDs   bool                `json:"numericIDs,omitempty"`
+	Mode         ManifestMode        `json:"mode,omitempty"`
+	Filesystem   string              `json:"filesystem,omitempty"`
+	APIVer       string              `json:"apiVersion,omitempty"`
+	IgnitionVer  string              `json:"ignitionVersion,omitempty"`
+	Compress     string              `json:"compress,omitempty"`
+	Encoding     string              `json:"encoding,omitempty"`
+	CAs          []string            `json:"certificateAuthorities,omitempty"`
+	Timeouts     ManifestTimeouts    `json:"timeouts,omitempty"`
+	Files        []ManifestFile      `json:"files,omitempty"`
+	Directories  []ManifestDirectory `json:"directories,omitempty"`
+	Links        []ManifestLink      `json:"links,omitempty"`
+	Units        []ManifestUnit      `json:"units,omitempty"`
+	Passwd       ManifestPasswd      `json:"passwd,omitempty"`
+	CreateOwners bool                `json:"createOwners,omitempty"`
+	SSHKeysFiles []string            `json:"sshKeysFiles,omitempty"`
+	SSHUser      string              `json:"sshUser,omitempty"`
+	CreatePool   bool                `json:"createPool,omitempty"`
+	// A number or a percentage
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	Paused         bool                `json:"paused,omitempty"`
+}
+
+// ManifestPasswd Users and groups to be created on the node
+type ManifestPasswd struct {
+	Users  []ManifestPasswdUser  `json:"users,omitempty"`
+	Groups []ManifestPasswdGroup `json:"groups,omitempty"`
+}
+
+// ManifestPasswdUser User to be created on the node
+type ManifestPasswdUser struct {
+	Name         string   `json:"name"`
+	UID          *int     `json:"uid,omitempty"`
+	HomeDir      string   `json:"homeDir,omitempty"`
+	Shell        string   `json:"shell,omitempty"`
+	Groups       []string `json:"groups,omitempty"`
+	PrimaryGroup string   `json:"primaryGroup,omitempty"`
+	System       bool     `json:"system,omitempty"`
+}
+
+// ManifestPasswdGroup Group to be created on the node
+type ManifestPasswdGroup struct {
+	Name   string `json:"name"`
+	GID    *int   `json:"gid,omitempty"`
+	System bool   `json:"system,omitempty"`
+}
+
+// ManifestFile Local file (or directory) to be written on the node
+type ManifestFile struct {
+	Local  string       `json:"local"`
+	Remote string       `json:"remote,omitempty"`
+	Mode   ManifestMode `json:"mode,omitempty"`
+	User   string       `json:"user,omitempty"`
+	Group  string       `json:"group,omitempty"`
+	UID    *int         `json:"uid,omitempty"`
+	GID    *int         `json:"gid,omitempty"`
+	Source string       `json:"source,omitempty"`
+}
+
+// ManifestTimeouts Ignition HTTP timeouts in seconds
+type ManifestTimeouts struct {
+	HTTPResponseHeaders int `json:"httpResponseHeaders,omitempty"`
+	HTTPTotal           int `json:"httpTotal,omitempty"`
+}
+
+// ManifestDirectory Directory to be created on the node
+type ManifestDirectory struct {
+	Path  string       `json:"path"`
+	Mode  ManifestMode `json:"mode,omitempty"`
+	User  string       `json:"user,omitempty"`
+	Group string       `json:"group,omitempty"`
+	UID   *int         `json:"uid,omitempty"`
+	GID   *int         `json:"gid,omitempty"`
+}
+
+// ManifestLink Symbolic or hard link to be created on the node
+type ManifestLink struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+	Hard   bool   `json:"hard,omitempty"`
+	User   string `json:"user,omitempty"`
+	Group  string `json:"group,omitempty"`
+	UID    *int   `json:"uid,omitempty"`
+	GID    *int   `json:"gid,omitempty"`
+}
+
+// ManifestUnit Systemd unit, contents are inline or read from a local file
+type ManifestUnit struct {
+	Name     string           `json:"name"`
+	File     string           `json:"file,omitempty"`
+	Contents string           `json:"contents,omitempty"`
+	Enabled  *bool            `json:"enabled,omitempty"`
+	Mask     bool             `json:"mask,omitempty"`
+	Dropins  []ManifestDropin `json:"dropins,omitempty"`
+}
+
+// ManifestDropin Systemd unit dropin, contents are inline or read from a local file
+type ManifestDropin struct {
+	Name     string `json:"name"`
+	File     string `json:"file,omitempty"`
+	Contents string `json:"contents,omitempty"`
+}
+
+// ManifestMode Permission mode, octal if quoted ("0644"), as is otherwise
+type ManifestMode int
+
+// UnmarshalJSON Parse a mode from a number or an octal string
+func (m *ManifestMode) UnmarshalJSON(data []byte) error {
+	var octal string
+	if err := json.Unmarshal(data, &octal); err == nil {
+		mode, err := strconv.ParseInt(octal, 8, 0)
+		if err != nil {
+			return fmt.Errorf("invalid mode %s", octal)
+		}
+		*m = ManifestMode(mode)
+		return nil
+	}
+	var mode int
+	if err := json.Unmarshal(data, &mode); err != nil {
+		return err
+	}
+	*m = ManifestMode(mode)
+	return nil
+}
+
+// parseManifest Creates a Manifest from YAML or JSON content, unknown keys are rejected
+func parseManifest(content []byte) (Manifest, error) {
+	var manifest Manifest
+	jsoncontent, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return manifest, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsoncontent))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&manifest)
+	return manifest, err
+}
+
+// manifestPath Local paths in the manifest are relative to the manifest itself
+func manifestPath(base string, local string) string {
+	if local == "" || filepath.IsAbs(local) {
+		return local
+	}
+	return filepath.Join(base, local)
+}
+
+// manifestContents Returns the inline contents or the content of the local file
+func manifestContents(base string, name string, local string, contents string) string {
+	if local != "" && contents != "" {
+		log.Fatalf("%s can't have both file and contents", name)
+	}
+	if local == "" {
+		return contents
+	}
+	f, err := ioutil.ReadFile(manifestPath(base, local))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(f)
+}
+
+// manifestLabels Creates the labels string (as used in Parameters) from the manifest labels and roles
+func manifestLabels(manifest Manifest) string {
+	labelmap := make(map[string]string)
+	for k, v := range manifest.Labels {
+		labelmap[k] = v
+	}
+	// Several roles generate a MachineConfig each, see NewMachineConfigs
+	if len(manifest.Roles) == 1 {
+		labelmap[roleLabel] = manifest.Roles[0]
+	}
+	return labelsString(labelmap)
+}
+
+// labelsString Creates the labels string (as used in Parameters) from a label map
+func labelsString(labelmap map[string]string) string {
+	var keys []string
+	for k := range labelmap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var labels []string
+	for _, k := range keys {
+		labels = append(labels, k+": "+labelmap[k])
+	}
+	return strings.Join(labels, ",")
+}
+
+// LoadManifest Fill the parameters not provided as flags with the manifest content
+func LoadManifest(file string, rawdata *Parameters) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifest, err := parseManifest(content)
+	if err != nil {
+		log.Fatalf("Invalid manifest %s: %s", file, err)
+	}
+	base := filepath.Dir(file)
+
+	if rawdata.Name == "" {
+		rawdata.Name = manifest.Name
+	}
+	if rawdata.Labels == "" {
+		rawdata.Labels = manifestLabels(manifest)
+	}
+	if rawdata.Roles == "" && len(manifest.Roles) > 1 {
+		rawdata.Roles = strings.Join(manifest.Roles, ",")
+	}
+	// An owner provided as a flag replaces the manifest one, name or id
+	if rawdata.User == "" && rawdata.UID == "" {
+		rawdata.User = manifest.User
+		if manifest.UID != nil {
+			rawdata.UID = strconv.Itoa(*manifest.UID)
+		}
+	}
+	if rawdata.Group == "" && rawdata.GID == "" {
+		rawdata.Group = manifest.Group
+		if manifest.GID != nil {
+			rawdata.GID = strconv.Itoa(*manifest.GID)
+		}
+	}
+	if rawdata.OwnerMap == "" {
+		rawdata.OwnerMap = manifestPath(base, manifest.OwnerMap)
+	}
+	if !rawdata.SetFlags["numeric-ids"] {
+		rawdata.NumericIDs = manifest.NumericIDs
+	}
+	if !rawdata.SetFlags["create-owners"] {
+		rawdata.CreateOwners = manifest.CreateOwners
+	}
+	if rawdata.SSHUser == "" {
+		rawdata.SSHUser = manifest.SSHUser
+	}
+	if !rawdata.SetFlags["create-pool"] {
+		rawdata.CreatePool = manifest.CreatePool
+	}
+	if rawdata.MaxUnavailable == "" && manifest.MaxUnavailable != nil {
+		rawdata.MaxUnavailable = manifest.MaxUnavailable.String()
+	}
+	if !rawdata.SetFlags["paused"] {
+		rawdata.Paused = manifest.Paused
+	}
+	for _, keys := range manifest.SSHKeysFiles {
+		rawdata.SSHKeysFiles = append(rawdata.SSHKeysFiles, manifestPath(base, keys))
+	}
+	if rawdata.Mode == 0 {
+		rawdata.Mode = int(manifest.Mode)
+	}
+	if rawdata.Filesystem == "" {
+		rawdata.Filesystem = manifest.Filesystem
+	}
+	if rawdata.APIVer == "" {
+		rawdata.APIVer = manifest.APIVer
+	}
+	if rawdata.IgnitionVer == "" {
+		rawdata.IgnitionVer = manifest.IgnitionVer
+	}
+	if rawdata.Compress == "" {
+		rawdata.Compress = manifest.Compress
+	}
+	if rawdata.Content == "" {
+		rawdata.Content = manifest.Encoding
+	}
+	if rawdata.HTTPResponseHeaders == 0 {
+		rawdata.HTTPResponseHeaders = manifest.Timeouts.HTTPResponseHeaders
+	}
+	if rawdata.HTTPTotal == 0 {
+		rawdata.HTTPTotal = manifest.Timeouts.HTTPTotal
+	}
+	for _, ca := range manifest.CAs {
+		if !strings.Contains(ca, "://") {
+			ca = manifestPath(base, ca)
+		}
+		rawdata.CAs = append(rawdata.CAs, ca)
+	}
+
+	for _, f := range manifest.Files {
+		if f.Local == "" {
+			log.Fatalf("Invalid manifest %s: files require local", file)
+		}
+		rawdata.Entries = append(rawdata.Entries, Entry{
+			LocalPath:  manifestPath(base, f.Local),
+			RemotePath: f.Remote,
+			Mode:       int(f.Mode),
+			User:       f.User,
+			Group:      f.Group,
+			UID:        f.UID,
+			GID:        f.GID,
+			Source:     f.Source,
+		})
+	}
+	for _, d := range manifest.Directories {
+		rawdata.Entries = append(rawdata.Entries, Entry{
+			RemotePath: d.Path,
+			Mode:       int(d.Mode),
+			User:       d.User,
+			Group:      d.Group,
+			UID:        d.UID,
+			GID:        d.GID,
+			Directory:  true,
+		})
+	}
+	for _, l := range manifest.Links {
+		if l.Target == "" {
+			log.Fatalf("Invalid manifest %s: link %s requires target", file, l.Path)
+		}
+		rawdata.Entries = append(rawdata.Entries, Entry{
+			RemotePath: l.Path,
+			Target:     l.Target,
+			Hard:       l.Hard,
+			User:       l.User,
+			Group:      l.Group,
+			UID:        l.UID,
+			GID:        l.GID,
+		})
+	}
+	for _, u := range manifest.Units {
+		unit := igntypes.Unit{
+			Name:     u.Name,
+			Contents: manifestContents(base, u.Name, u.File, u.Contents),
+			Enabled:  u.Enabled,
+			Mask:     u.Mask,
+		}
+		for _, d := range u.Dropins {
+			unit.Dropins = append(unit.Dropins, igntypes.SystemdDropin{
+				Name:     d.Name,
+				Contents: manifestContents(base, d.Name, d.File, d.Contents),
+			})
+		}
+		rawdata.Units = append(rawdata.Units, unit)
+	}
+	for _, u := range manifest.Passwd.Users {
+		user := igntypes.PasswdUser{
+			Name:         u.Name,
+			UID:          u.UID,
+			HomeDir:      u.HomeDir,
+			Shell:        u.Shell,
+			PrimaryGroup: u.PrimaryGroup,
+			System:       u.System,
+		}
+		for _, g := range u.Groups {
+			user.Groups = append(user.Groups, igntypes.Group(g))
+		}
+		rawdata.PasswdUsers = append(rawdata.PasswdUsers, user)
+	}
+	for _, g := range manifest.Passwd.Groups {
+		rawdata.PasswdGroups = append(rawdata.PasswdGroups, igntypes.PasswdGroup{
+			Name:   g.Name,
+			Gid:    g.GID,
+			System: g.System,
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package converter
+
+import (
+	"bufio"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	MachineConfig "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+)
+
+// Header of the files written to the output directory, only files starting with it are overwritten
+var generatedHeader = "# Generated by file-to-machineconfig, local changes are overwritten"
+var defaultManifestMode = 0644
+
+// manifestFileName Returns the file name openshift-install uses for an object
+func manifestFileName(kind string, name string) string {
+	return "99_openshift-" + strings.ToLower(kind) + "_" + name + ".yaml"
+}
+
+// isGenerated Verify an existing file was written by this tool
+func isGenerated(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return false, nil
+	}
+	return strings.TrimRight(line, "\r\n") == generatedHeader, nil
+}
+
+// writeAtomic Write a file through a temporary file renamed over it, so it's never half written
+func writeAtomic(file string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".")
+	if err != nil {
+		return err
+	}
+	// Nothing to remove once renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// TempFile creates the file readable only by its owner
+	if err := os.Chmod(tmp.Name(), os.FileMode(defaultManifestMode)); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// WriteObjects Writes every MachineConfig and MachineConfigPool as YAML to a file in dir, updating the ones generated before
+func WriteObjects(mcs []MachineConfigObject, pools []MachineConfig.MachineConfigPool, dir string) {
+	files := make(map[string]string)
+	var names []string
+	add := func(kind string, name string, object interface{}) {
+		file := filepath.Join(dir, manifestFileName(kind, name))
+		files[file] = generatedHeader + "\n" + objectOutput(object, "yaml")
+		names = append(names, file)
+	}
+	for _, mc := range mcs {
+		add(mc.Kind, mc.Name, renderMachineConfig(mc))
+	}
+	for _, pool := range pools {
+		add(pool.Kind, pool.Name, renderMachineConfigPool(pool))
+	}
+
+	// Check every file first, nothing is written if any of them can't be
+	if err := os.MkdirAll(dir, os.FileMode(defaultDirectoryMode)); err != nil {
+		log.Fatal(err)
+	}
+	existing := make(map[string]bool)
+	for _, file := range names {
+		generated, err := isGenerated(file)
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			log.Fatal(err)
+		case !generated:
+			log.Fatalf("%s already exists and wasn't generated by file-to-machineconfig, not overwriting it", file)
+		}
+		existing[file] = true
+	}
+
+	for _, file := range names {
+		if existing[file] {
+			log.Printf("updating %s", file)
+		} else {
+			log.Printf("creating %s", file)
+		}
+		if err := writeAtomic(file, []byte(files[file])); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
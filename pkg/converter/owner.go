@@ -0,0 +1,102 @@
+package converter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+)
+
+// OwnerMap Translates the owners of local files (names or ids) to node owners, numeric node owners are ids
+type OwnerMap struct {
+	Users  map[string]NodeOwner `json:"users,omitempty"`
+	Groups map[string]NodeOwner `json:"groups,omitempty"`
+}
+
+// NodeOwner Owner name or id on the node
+type NodeOwner string
+
+// UnmarshalJSON Accept both names and ids
+func (o *NodeOwner) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*o = NodeOwner(name)
+		return nil
+	}
+	var id int
+	if err := json.Unmarshal(data, &id); err != nil {
+		return err
+	}
+	*o = NodeOwner(strconv.Itoa(id))
+	return nil
+}
+
+// ownerOptions How the owners of local files become node owners
+type ownerOptions struct {
+	Map        OwnerMap
+	NumericIDs bool
+}
+
+// loadOwnerMap Creates an OwnerMap from a YAML or JSON file
+func loadOwnerMap(file string) OwnerMap {
+	var owners OwnerMap
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := yaml.Unmarshal(content, &owners); err != nil {
+		log.Fatalf("Invalid owner map %s: %s", file, err)
+	}
+	return owners
+}
+
+// parseOwner Returns the name or the id of an owner, numeric owners are ids
+func parseOwner(owner string) (string, *int) {
+	if id, err := strconv.Atoi(owner); err == nil {
+		return "", &id
+	}
+	return owner, nil
+}
+
+// parseID Returns the id provided as a flag, nil if not provided
+func parseID(kind string, value string) *int {
+	if value == "" {
+		return nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		log.Fatalf("Invalid %s %s, it must be a number", kind, value)
+	}
+	return &id
+}
+
+// nodeUser Returns the node user of a local file owned by name (empty if it can't be resolved) and id
+func (o ownerOptions) nodeUser(entry *Entry, name string, id string) (string, *int) {
+	return o.nodeOwner("user", "uid", entry, name, id, o.Map.Users)
+}
+
+// nodeGroup Returns the node group of a local file owned by name (empty if it can't be resolved) and id
+func (o ownerOptions) nodeGroup(entry *Entry, name string, id string) (string, *int) {
+	return o.nodeOwner("group", "gid", entry, name, id, o.Map.Groups)
+}
+
+// nodeOwner The owner map wins, then the local name and, if it can't be resolved, the local id if allowed
+func (o ownerOptions) nodeOwner(kind string, idkind string, entry *Entry, name string, id string, mapping map[string]NodeOwner) (string, *int) {
+	for _, local := range []string{name, id} {
+		if owner, ok := mapping[local]; ok && local != "" {
+			log.Printf("%s not provided for '%s', using '%s' mapped from '%s'", kind, entry.RemotePath, owner, local)
+			return parseOwner(string(owner))
+		}
+	}
+	if name != "" {
+		log.Printf("%s not provided for '%s', using '%s' as the original file", kind, entry.RemotePath, name)
+		return name, nil
+	}
+	if !o.NumericIDs {
+		log.Fatalf("The %s of %s (%s %s) doesn't exist, use --%s, --%s, --owner-map or --numeric-ids", kind, entry.LocalPath, idkind, id, kind, idkind)
+	}
+	log.Printf("%s not provided for '%s', using %s %s as the original file", kind, entry.RemotePath, idkind, id)
+	return parseOwner(id)
+}
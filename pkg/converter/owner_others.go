@@ -11,21 +11,29 @@ import (
 )
 
 // SetUserGroupMode Set destination file parameters
-func SetUserGroupMode(file os.FileInfo, rawdata *Parameters) {
-	if rawdata.User == "" {
-		fileuser, _ := user.LookupId(strconv.Itoa(int(file.Sys().(*syscall.Stat_t).Uid)))
-		log.Printf("user not provided, using '%s' as the original file", fileuser.Username)
-		rawdata.User = fileuser.Username
+func SetUserGroupMode(file os.FileInfo, entry *Entry, owners ownerOptions) {
+	stat := file.Sys().(*syscall.Stat_t)
+	if entry.User == "" && entry.UID == nil {
+		uid := strconv.Itoa(int(stat.Uid))
+		name := ""
+		if fileuser, err := user.LookupId(uid); err == nil {
+			name = fileuser.Username
+		}
+		entry.User, entry.UID = owners.nodeUser(entry, name, uid)
 	}
-	if rawdata.Group == "" {
-		filegroup, _ := user.LookupId(strconv.Itoa(int(file.Sys().(*syscall.Stat_t).Gid)))
-		log.Printf("group not provided, using '%s' as the original file", filegroup.Username)
-		rawdata.Group = filegroup.Username
+	if entry.Group == "" && entry.GID == nil {
+		gid := strconv.Itoa(int(stat.Gid))
+		name := ""
+		if filegroup, err := user.LookupGroupId(gid); err == nil {
+			name = filegroup.Name
+		}
+		entry.Group, entry.GID = owners.nodeGroup(entry, name, gid)
 	}
-	if rawdata.Mode == 0 {
+	// Links have no mode
+	if entry.Mode == 0 && entry.Target == "" {
 		filemode := file.Mode().Perm()
-		log.Printf("mode not provided, using '%#o' as the original file", filemode)
+		log.Printf("mode not provided for '%s', using '%#o' as the original file", entry.RemotePath, filemode)
 		// Ignition requires decimal
-		rawdata.Mode = int(filemode)
+		entry.Mode = int(filemode)
 	}
 }
@@ -12,19 +12,24 @@ var defaultMode = 0644
 var defaultUsername = "root"
 var defaultGroupname = "root"
 
-// SetUserGroupMode Set destination file parameters
-func SetUserGroupMode(file os.FileInfo, rawdata *Parameters) {
-	if rawdata.User == "" && runtime.GOOS == "windows" {
-		log.Printf("user not provided, using '%s' as default", defaultUsername)
-		rawdata.User = defaultUsername
+// SetUserGroupMode Set destination file parameters, local owners are not used on Windows
+func SetUserGroupMode(file os.FileInfo, entry *Entry, owners ownerOptions) {
+	if entry.User == "" && entry.UID == nil && runtime.GOOS == "windows" {
+		log.Printf("user not provided for '%s', using '%s' as default", entry.RemotePath, defaultUsername)
+		entry.User = defaultUsername
 	}
 	defaultGroupname := "root"
-	if rawdata.Group == "" && runtime.GOOS == "windows" {
-		log.Printf("group not provided, using '%s' as default", defaultGroupname)
-		rawdata.Group = defaultGroupname
+	if entry.Group == "" && entry.GID == nil && runtime.GOOS == "windows" {
+		log.Printf("group not provided for '%s', using '%s' as default", entry.RemotePath, defaultGroupname)
+		entry.Group = defaultGroupname
 	}
-	if rawdata.Mode == 0 && runtime.GOOS == "windows" {
-		log.Printf("mode not provided, using '%#o' as default", defaultMode)
-		rawdata.Mode = int(defaultMode)
+	// Links have no mode
+	if entry.Mode == 0 && entry.Target == "" && runtime.GOOS == "windows" {
+		mode := defaultMode
+		if file.IsDir() {
+			mode = defaultDirectoryMode
+		}
+		log.Printf("mode not provided for '%s', using '%#o' as default", entry.RemotePath, mode)
+		entry.Mode = int(mode)
 	}
 }
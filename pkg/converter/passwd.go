@@ -0,0 +1,161 @@
+package converter
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+)
+
+// Accounts shipped with RHCOS, they never need to be created
+var systemAccounts = []string{
+	"root", "bin", "daemon", "adm", "lp", "sync", "shutdown", "halt", "mail", "operator",
+	"games", "ftp", "nobody", "dbus", "polkitd", "sshd", "chrony", "core", "systemd-coredump",
+	"systemd-network", "systemd-resolve", "systemd-timesync", "tss", "rpc", "rpcuser",
+	"unbound", "sssd", "setroubleshoot", "clevis", "dnsmasq", "openvswitch", "hugetlbfs",
+	"containers", "wheel", "kvm", "video", "audio", "disk", "input", "render", "utmp",
+	"utempter", "tty", "kmem", "cdrom", "tape", "dialout", "floppy", "lock", "users",
+	"ssh_keys", "systemd-journal", "zincati",
+}
+
+// Account names useradd/groupadd accept
+var accountNameRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_.-]*[$]?$`)
+
+// parseUserSpec Creates a passwd user from name[:uid[:home[:shell[:group,group...]]]]
+func parseUserSpec(spec string) igntypes.PasswdUser {
+	parts := strings.Split(spec, ":")
+	if len(parts) > 5 || parts[0] == "" {
+		log.Fatalf("Invalid user %s, expected name[:uid[:home[:shell[:group,group...]]]]", spec)
+	}
+	parts = append(parts, make([]string, 5-len(parts))...)
+
+	u := igntypes.PasswdUser{
+		Name:    parts[0],
+		UID:     parseID("uid", parts[1]),
+		HomeDir: parts[2],
+		Shell:   parts[3],
+	}
+	if parts[4] != "" {
+		for _, g := range strings.Split(parts[4], ",") {
+			u.Groups = append(u.Groups, igntypes.Group(g))
+		}
+	}
+	return u
+}
+
+// parseGroupSpec Creates a passwd group from name[:gid]
+func parseGroupSpec(spec string) igntypes.PasswdGroup {
+	parts := strings.Split(spec, ":")
+	if len(parts) > 2 || parts[0] == "" {
+		log.Fatalf("Invalid group %s, expected name[:gid]", spec)
+	}
+	parts = append(parts, make([]string, 2-len(parts))...)
+	return igntypes.PasswdGroup{
+		Name: parts[0],
+		Gid:  parseID("gid", parts[1]),
+	}
+}
+
+// parsePasswd Add the users and groups provided as flags
+func parsePasswd(rawdata *Parameters) {
+	for _, spec := range rawdata.CreateUsers {
+		rawdata.PasswdUsers = append(rawdata.PasswdUsers, parseUserSpec(spec))
+	}
+	for _, spec := range rawdata.CreateGroups {
+		rawdata.PasswdGroups = append(rawdata.PasswdGroups, parseGroupSpec(spec))
+	}
+}
+
+// findPasswdUser Returns the index of the named user, -1 if it isn't declared
+func findPasswdUser(users []igntypes.PasswdUser, name string) int {
+	for i := range users {
+		if users[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// findPasswdGroup Returns the index of the named group, -1 if it isn't declared
+func findPasswdGroup(groups []igntypes.PasswdGroup, name string) int {
+	for i := range groups {
+		if groups[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasUserGroup Verify a declared user gets a group with its own name
+func hasUserGroup(users []igntypes.PasswdUser, name string) bool {
+	i := findPasswdUser(users, name)
+	return i >= 0 && !users[i].NoUserGroup && users[i].PrimaryGroup == ""
+}
+
+// createOwners Declares the users and groups owning the nodes that don't exist in RHCOS
+func createOwners(rawdata *Parameters) {
+	for _, entry := range rawdata.Entries {
+		if entry.User != "" && !stringInList(entry.User, systemAccounts) && findPasswdUser(rawdata.PasswdUsers, entry.User) < 0 {
+			log.Printf("user '%s' is not a system account, creating it", entry.User)
+			rawdata.PasswdUsers = append(rawdata.PasswdUsers, igntypes.PasswdUser{Name: entry.User})
+		}
+	}
+	// useradd creates a group named after the user, creating it here would make useradd fail
+	for _, entry := range rawdata.Entries {
+		if entry.Group != "" && !stringInList(entry.Group, systemAccounts) && findPasswdGroup(rawdata.PasswdGroups, entry.Group) < 0 &&
+			!hasUserGroup(rawdata.PasswdUsers, entry.Group) {
+			log.Printf("group '%s' is not a system account, creating it", entry.Group)
+			rawdata.PasswdGroups = append(rawdata.PasswdGroups, igntypes.PasswdGroup{Name: entry.Group})
+		}
+	}
+}
+
+// checkPasswd Verify the users and groups to be created
+func checkPasswd(rawdata *Parameters) {
+	for i, g := range rawdata.PasswdGroups {
+		if !accountNameRegexp.MatchString(g.Name) {
+			log.Fatalf("Invalid group name %s", g.Name)
+		}
+		if findPasswdGroup(rawdata.PasswdGroups[:i], g.Name) >= 0 {
+			log.Fatalf("Group %s is duplicated", g.Name)
+		}
+		// useradd fails if the group named after the user already exists
+		if hasUserGroup(rawdata.PasswdUsers, g.Name) {
+			log.Printf("group '%s' is created explicitly, using it as the primary group of user '%s'", g.Name, g.Name)
+			rawdata.PasswdUsers[findPasswdUser(rawdata.PasswdUsers, g.Name)].PrimaryGroup = g.Name
+		}
+	}
+	for i, u := range rawdata.PasswdUsers {
+		if !accountNameRegexp.MatchString(u.Name) {
+			log.Fatalf("Invalid user name %s", u.Name)
+		}
+		if findPasswdUser(rawdata.PasswdUsers[:i], u.Name) >= 0 {
+			log.Fatalf("User %s is duplicated", u.Name)
+		}
+		if u.HomeDir != "" && !isRemoteAbs(u.HomeDir) {
+			log.Fatalf("Home directory %s of user %s is not an absolute path", u.HomeDir, u.Name)
+		}
+		if u.Shell != "" && !isRemoteAbs(u.Shell) {
+			log.Fatalf("Shell %s of user %s is not an absolute path", u.Shell, u.Name)
+		}
+		for _, g := range u.Groups {
+			if !accountNameRegexp.MatchString(string(g)) {
+				log.Fatalf("Invalid supplementary group %s of user %s", g, u.Name)
+			}
+		}
+	}
+	checkPasswdUpdates(rawdata)
+}
+
+// checkPasswdUpdates Warn about the users and groups the MCO can only create at install time
+func checkPasswdUpdates(rawdata *Parameters) {
+	for _, u := range rawdata.PasswdUsers {
+		if u.Name != defaultSSHUser {
+			log.Printf("the machine-config-operator refuses updates changing users other than '%s', user '%s' can only be created at install time", defaultSSHUser, u.Name)
+		}
+	}
+	for _, g := range rawdata.PasswdGroups {
+		log.Printf("the machine-config-operator refuses updates changing groups, group '%s' can only be created at install time", g.Name)
+	}
+}
@@ -0,0 +1,278 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	MachineConfig "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Files loaded from a manifests directory
+var manifestExtensions = []string{".yaml", ".yml", ".json"}
+
+// Pools every cluster has, any other pool also gets the worker MachineConfigs
+var defaultPools = []string{"master", "worker"}
+
+// splitDocuments Splits a YAML stream in documents
+func splitDocuments(content []byte) [][]byte {
+	var documents [][]byte
+	var current []byte
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if strings.TrimSpace(string(line)) == "---" {
+			documents = append(documents, current)
+			current = nil
+			continue
+		}
+		current = append(current, line...)
+	}
+	return append(documents, current)
+}
+
+// loadObjects Adds the MachineConfigs and MachineConfigPools of a JSON object, lists included
+func loadObjects(jsoncontent []byte, mcs *[]MachineConfigObject, pools *[]MachineConfig.MachineConfigPool) error {
+	var header struct {
+		metav1.TypeMeta `json:",inline"`
+		Items           []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(jsoncontent, &header); err != nil {
+		return err
+	}
+	switch header.Kind {
+	case "MachineConfig":
+		mc, err := decodeMachineConfig(jsoncontent)
+		if err != nil {
+			return err
+		}
+		*mcs = append(*mcs, mc)
+	case "MachineConfigPool":
+		var pool MachineConfig.MachineConfigPool
+		if err := json.Unmarshal(jsoncontent, &pool); err != nil {
+			return err
+		}
+		*pools = append(*pools, pool)
+	case "List", "MachineConfigList", "MachineConfigPoolList":
+		for _, item := range header.Items {
+			if err := loadObjects(item, mcs, pools); err != nil {
+				return err
+			}
+		}
+	}
+	// Any other object in the directory is not relevant
+	return nil
+}
+
+// LoadDirectory Returns the MachineConfigs and MachineConfigPools of the manifests in a directory, sorted by name
+func LoadDirectory(dir string) ([]MachineConfigObject, []MachineConfig.MachineConfigPool) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var mcs []MachineConfigObject
+	var pools []MachineConfig.MachineConfigPool
+	origins := make(map[string]string)
+	for _, f := range files {
+		if f.IsDir() || !stringInList(strings.ToLower(filepath.Ext(f.Name())), manifestExtensions) {
+			continue
+		}
+		file := filepath.Join(dir, f.Name())
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, document := range splitDocuments(content) {
+			jsoncontent, err := yaml.YAMLToJSON(document)
+			if err != nil {
+				log.Fatalf("Invalid manifest %s: %s", file, err)
+			}
+			if string(jsoncontent) == "null" {
+				continue
+			}
+			n := len(mcs)
+			if err := loadObjects(jsoncontent, &mcs, &pools); err != nil {
+				log.Fatalf("Invalid manifest %s: %s", file, err)
+			}
+			// The API server would reject the second one
+			for _, mc := range mcs[n:] {
+				if origin, ok := origins[mc.Name]; ok {
+					log.Fatalf("MachineConfig %s is defined in %s and %s", mc.Name, origin, file)
+				}
+				origins[mc.Name] = file
+			}
+		}
+	}
+	// The MCO merges the MachineConfigs in lexical order
+	sort.Slice(mcs, func(i, j int) bool { return mcs[i].Name < mcs[j].Name })
+	return mcs, pools
+}
+
+// defaultPoolSelector Returns the MachineConfigSelector the MCO documents for a pool, custom pools include the worker MachineConfigs
+func defaultPoolSelector(pool string) *metav1.LabelSelector {
+	if stringInList(pool, defaultPools) {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{roleLabel: pool}}
+	}
+	return &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      roleLabel,
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   []string{"worker", pool},
+		}},
+	}
+}
+
+// poolSelector Returns the selector of a pool, the one of its MachineConfigPool if there is any
+func poolSelector(pool string, pools []MachineConfig.MachineConfigPool) labels.Selector {
+	selector := defaultPoolSelector(pool)
+	for _, p := range pools {
+		if p.Name == pool {
+			selector = p.Spec.MachineConfigSelector
+		}
+	}
+	// A nil selector selects nothing
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		log.Fatalf("Invalid MachineConfigSelector in pool %s: %s", pool, err)
+	}
+	return s
+}
+
+// SelectMachineConfigs Returns the MachineConfigs of a pool, keeping their order
+func SelectMachineConfigs(pool string, mcs []MachineConfigObject, pools []MachineConfig.MachineConfigPool) []MachineConfigObject {
+	selector := poolSelector(pool, pools)
+	var selected []MachineConfigObject
+	for _, mc := range mcs {
+		if selector.Matches(labels.Set(mc.Labels)) {
+			selected = append(selected, mc)
+		}
+	}
+	return selected
+}
+
+// Labels of the pools, KubeletConfigs and ContainerRuntimeConfigs select pools by it
+var poolLabelPrefix = "pools.operator.machineconfiguration.openshift.io/"
+var nodeRolePrefix = "node-role.kubernetes.io/"
+
+// machineConfigPoolSpecRaw MachineConfigPoolSpec as current MCOs read it, the vendored one names the node selector machineSelector
+type machineConfigPoolSpecRaw struct {
+	MachineConfigSelector *metav1.LabelSelector `json:"machineConfigSelector,omitempty"`
+	NodeSelector          *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+	Paused                bool                  `json:"paused"`
+	MaxUnavailable        *intstr.IntOrString   `json:"maxUnavailable,omitempty"`
+}
+
+// machineConfigPoolRaw MachineConfigPool without status, the MCO fills it
+type machineConfigPoolRaw struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec machineConfigPoolSpecRaw `json:"spec"`
+}
+
+// renderMachineConfigPool Returns the object to be printed for a MachineConfigPool
+func renderMachineConfigPool(pool MachineConfig.MachineConfigPool) interface{} {
+	return machineConfigPoolRaw{
+		TypeMeta:   pool.TypeMeta,
+		ObjectMeta: pool.ObjectMeta,
+		Spec: machineConfigPoolSpecRaw{
+			MachineConfigSelector: pool.Spec.MachineConfigSelector,
+			NodeSelector:          pool.Spec.MachineSelector,
+			Paused:                pool.Spec.Paused,
+			MaxUnavailable:        pool.Spec.MaxUnavailable,
+		},
+	}
+}
+
+// machineConfigRoles Returns the roles of the generated MachineConfigs
+func machineConfigRoles(data Parameters) []string {
+	if data.Roles != "" {
+		return splitRoles(data.Roles)
+	}
+	if data.Labels != "" {
+		if role := labelsToMap(data.Labels)[roleLabel]; role != "" {
+			return []string{role}
+		}
+	}
+	return nil
+}
+
+// poolRoles Returns the roles needing a pool, the master and worker pools always exist
+func poolRoles(data Parameters) []string {
+	var custom []string
+	for _, role := range machineConfigRoles(data) {
+		if !stringInList(role, defaultPools) {
+			custom = append(custom, role)
+		}
+	}
+	return custom
+}
+
+// parseMaxUnavailable Returns the MaxUnavailable of a pool from a number or a percentage
+func parseMaxUnavailable(value string) *intstr.IntOrString {
+	maxUnavailable := intstr.Parse(value)
+	if maxUnavailable.Type == intstr.String {
+		percent, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+		if !strings.HasSuffix(value, "%") || err != nil || percent < 1 || percent > 100 {
+			log.Fatalf("Invalid max unavailable %s, expected a number or a percentage", value)
+		}
+	} else if maxUnavailable.IntVal < 1 {
+		log.Fatalf("Invalid max unavailable %s, the nodes of the pool would never be updated", value)
+	}
+	return &maxUnavailable
+}
+
+// checkPool Verify a pool can be created with the settings provided
+func checkPool(rawdata *Parameters) {
+	if rawdata.MaxUnavailable != "" {
+		parseMaxUnavailable(rawdata.MaxUnavailable)
+	}
+	for _, role := range machineConfigRoles(*rawdata) {
+		if stringInList(role, defaultPools) {
+			log.Printf("the %s pool exists in every cluster, not creating it", role)
+		}
+	}
+	if len(poolRoles(*rawdata)) == 0 {
+		log.Fatalf("A pool can only be created for a role other than %s", strings.Join(defaultPools, " or "))
+	}
+}
+
+// NewMachineConfigPools Creates the pools of the custom roles if requested, as the MCO documents them
+func NewMachineConfigPools(data Parameters) []MachineConfig.MachineConfigPool {
+	if !data.CreatePool {
+		return nil
+	}
+	var pools []MachineConfig.MachineConfigPool
+	for _, role := range poolRoles(data) {
+		pool := MachineConfig.MachineConfigPool{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: data.APIVer,
+				Kind:       "MachineConfigPool",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   role,
+				Labels: map[string]string{poolLabelPrefix + role: ""},
+			},
+			Spec: MachineConfig.MachineConfigPoolSpec{
+				MachineConfigSelector: defaultPoolSelector(role),
+				MachineSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{nodeRolePrefix + role: ""},
+				},
+				Paused: data.Paused,
+			},
+		}
+		if data.MaxUnavailable != "" {
+			pool.Spec.MaxUnavailable = parseMaxUnavailable(data.MaxUnavailable)
+		}
+		pools = append(pools, pool)
+	}
+	return pools
+}
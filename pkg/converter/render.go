@@ -0,0 +1,288 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+	MachineConfig "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RenderedPool The config of a pool and the MachineConfigs every node comes from
+type RenderedPool struct {
+	MachineConfig MachineConfigObject
+	// Selected MachineConfigs in merge order
+	Sources []string
+	// Path, "unit name", "dropin unit/name", "user name" or "group name" -> MachineConfigs writing it, the last one wins
+	Origins map[string][]string
+}
+
+// addOrigin Records a MachineConfig writing a node, once
+func (r *RenderedPool) addOrigin(node string, name string) {
+	origins := r.Origins[node]
+	if len(origins) > 0 && origins[len(origins)-1] == name {
+		return
+	}
+	r.Origins[node] = append(origins, name)
+}
+
+// mergeUnit Merges a unit into a previous one, the new contents and states win and dropins are merged by name
+func mergeUnit(base igntypes.Unit, add igntypes.Unit) igntypes.Unit {
+	if add.Contents != "" {
+		base.Contents = add.Contents
+	}
+	if add.Enabled != nil {
+		base.Enabled = add.Enabled
+	}
+	if add.Enable {
+		base.Enable = true
+	}
+	if add.Mask {
+		base.Mask = true
+	}
+	for _, d := range add.Dropins {
+		replaced := false
+		for i := range base.Dropins {
+			if base.Dropins[i].Name == d.Name {
+				base.Dropins[i] = d
+				replaced = true
+			}
+		}
+		if !replaced {
+			base.Dropins = append(base.Dropins, d)
+		}
+	}
+	return base
+}
+
+// mergeConfig Merges a MachineConfig into the rendered config, later nodes win per path and units are merged
+func (r *RenderedPool) mergeConfig(add MachineConfigObject) {
+	cfg := &r.MachineConfig.Spec.Config
+	name := add.Name
+
+	for _, f := range add.Spec.Config.Storage.Files {
+		r.addOrigin(f.Path, name)
+		replaced := false
+		for i := range cfg.Storage.Files {
+			if cfg.Storage.Files[i].Path == f.Path {
+				cfg.Storage.Files[i] = f
+				replaced = true
+			}
+		}
+		if !replaced {
+			removeNodePath(cfg, f.Path)
+			cfg.Storage.Files = append(cfg.Storage.Files, f)
+		}
+	}
+	for _, d := range add.Spec.Config.Storage.Directories {
+		r.addOrigin(d.Path, name)
+		removeNodePath(cfg, d.Path)
+		cfg.Storage.Directories = append(cfg.Storage.Directories, d)
+	}
+	for _, l := range add.Spec.Config.Storage.Links {
+		r.addOrigin(l.Path, name)
+		removeNodePath(cfg, l.Path)
+		cfg.Storage.Links = append(cfg.Storage.Links, l)
+	}
+
+	for _, u := range add.Spec.Config.Systemd.Units {
+		// Units only adding dropins don't override the unit
+		if u.Contents != "" || u.Enabled != nil || u.Enable || u.Mask {
+			r.addOrigin("unit "+u.Name, name)
+		}
+		for _, d := range u.Dropins {
+			r.addOrigin("dropin "+u.Name+"/"+d.Name, name)
+		}
+		if i := findUnitIn(cfg.Systemd.Units, u.Name); i >= 0 {
+			cfg.Systemd.Units[i] = mergeUnit(cfg.Systemd.Units[i], u)
+			continue
+		}
+		cfg.Systemd.Units = append(cfg.Systemd.Units, u)
+	}
+
+	// The ssh keys of every MachineConfig are kept
+	for _, u := range add.Spec.Config.Passwd.Users {
+		r.addOrigin("user "+u.Name, name)
+		i := findPasswdUser(cfg.Passwd.Users, u.Name)
+		if i < 0 {
+			cfg.Passwd.Users = append(cfg.Passwd.Users, u)
+			continue
+		}
+		keys := cfg.Passwd.Users[i].SSHAuthorizedKeys
+		for _, k := range u.SSHAuthorizedKeys {
+			found := false
+			for _, existing := range keys {
+				found = found || existing == k
+			}
+			if !found {
+				keys = append(keys, k)
+			}
+		}
+		cfg.Passwd.Users[i] = u
+		cfg.Passwd.Users[i].SSHAuthorizedKeys = keys
+	}
+	for _, g := range add.Spec.Config.Passwd.Groups {
+		r.addOrigin("group "+g.Name, name)
+		if i := findPasswdGroup(cfg.Passwd.Groups, g.Name); i >= 0 {
+			cfg.Passwd.Groups[i] = g
+			continue
+		}
+		cfg.Passwd.Groups = append(cfg.Passwd.Groups, g)
+	}
+
+	for _, ca := range add.Spec.Config.Ignition.Security.TLS.CertificateAuthorities {
+		found := false
+		for _, existing := range cfg.Ignition.Security.TLS.CertificateAuthorities {
+			found = found || existing.Source == ca.Source
+		}
+		if !found {
+			cfg.Ignition.Security.TLS.CertificateAuthorities = append(cfg.Ignition.Security.TLS.CertificateAuthorities, ca)
+		}
+	}
+	if add.Spec.Config.Ignition.Timeouts.HTTPResponseHeaders != nil {
+		cfg.Ignition.Timeouts.HTTPResponseHeaders = add.Spec.Config.Ignition.Timeouts.HTTPResponseHeaders
+	}
+	if add.Spec.Config.Ignition.Timeouts.HTTPTotal != nil {
+		cfg.Ignition.Timeouts.HTTPTotal = add.Spec.Config.Ignition.Timeouts.HTTPTotal
+	}
+}
+
+// mergeSpecFields Merges the spec fields outside of the ignition config as the MCO does: kernel arguments and extensions are appended, fips is enabled by any MachineConfig and the last kernel type wins
+func (r *RenderedPool) mergeSpecFields(add MachineConfigObject) {
+	if r.MachineConfig.SpecFields == nil {
+		r.MachineConfig.SpecFields = make(map[string]json.RawMessage)
+	}
+	fields := r.MachineConfig.SpecFields
+	for _, field := range specFieldNames(add) {
+		var err error
+		raw := add.SpecFields[field]
+		switch field {
+		case "kernelArguments", "extensions":
+			// Empty lists stay lists, as the MCO renders them
+			base, values := []string{}, []string{}
+			if fields[field] != nil {
+				if err = json.Unmarshal(fields[field], &base); err != nil {
+					break
+				}
+			}
+			if err = json.Unmarshal(raw, &values); err != nil {
+				break
+			}
+			for _, v := range values {
+				// Kernel arguments can be repeated, extensions are installed once
+				if field == "kernelArguments" || !stringInList(v, base) {
+					base = append(base, v)
+				}
+			}
+			fields[field], err = json.Marshal(base)
+		case "fips":
+			var base, value bool
+			if fields[field] != nil {
+				if err = json.Unmarshal(fields[field], &base); err != nil {
+					break
+				}
+			}
+			if err = json.Unmarshal(raw, &value); err != nil {
+				break
+			}
+			fields[field], err = json.Marshal(base || value)
+		case "kernelType":
+			var value string
+			if err = json.Unmarshal(raw, &value); err != nil {
+				break
+			}
+			if value != "" {
+				fields[field] = raw
+			}
+		default:
+			log.Printf("spec.%s of MachineConfig %s isn't merged by this tool, dropping it from the rendered config", field, add.Name)
+		}
+		if err != nil {
+			log.Fatalf("Invalid spec.%s in MachineConfig %s: %s", field, add.Name, err)
+		}
+	}
+	if len(fields) == 0 {
+		r.MachineConfig.SpecFields = nil
+	}
+}
+
+// renderVersion Returns the highest ignition version of the MachineConfigs, 2.2.0 at least, as spec 3 defaults (modes, overwrite) differ
+func renderVersion(mcs []MachineConfigObject) string {
+	version := defaultIgnitionVersion
+	for _, mc := range mcs {
+		// Supported versions only have single digits, they sort as strings
+		v := mc.Spec.Config.Ignition.Version
+		if supportedIgnitionVersion(v) && v > version {
+			version = v
+		}
+	}
+	return version
+}
+
+// RenderPool Merges the MachineConfigs of a pool in lexical order, as the MCO renders the config of its nodes
+func RenderPool(pool string, mcs []MachineConfigObject, pools []MachineConfig.MachineConfigPool) RenderedPool {
+	selected := SelectMachineConfigs(pool, mcs, pools)
+	if len(selected) == 0 {
+		log.Fatalf("No MachineConfig selected by pool %s", pool)
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Name < selected[j].Name })
+
+	r := RenderedPool{
+		MachineConfig: MachineConfigObject{
+			MachineConfig: MachineConfig.MachineConfig{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: defaultApiversion,
+					Kind:       "MachineConfig",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "rendered-" + pool,
+				},
+				// As MergeMachineConfigs, the OS image of the first MachineConfig is used
+				Spec: MachineConfig.MachineConfigSpec{
+					OSImageURL: selected[0].Spec.OSImageURL,
+				},
+			},
+		},
+		Origins: make(map[string][]string),
+	}
+	r.MachineConfig.Spec.Config.Ignition.Version = renderVersion(selected)
+	for _, mc := range selected {
+		r.Sources = append(r.Sources, mc.Name)
+		r.mergeConfig(mc)
+		r.mergeSpecFields(mc)
+	}
+	return r
+}
+
+// RenderedPoolOutput Returns the rendered MachineConfig as YAML, with comments telling which MachineConfig each node comes from
+func RenderedPoolOutput(r RenderedPool) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# %s rendered from %s\n", r.MachineConfig.Name, strings.Join(r.Sources, ", "))
+
+	var nodes []string
+	for node := range r.Origins {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		origins := r.Origins[node]
+		fmt.Fprintf(&out, "# %s: %s", node, origins[len(origins)-1])
+		if len(origins) > 1 {
+			fmt.Fprintf(&out, " (overrides %s)", strings.Join(origins[:len(origins)-1], ", "))
+		}
+		fmt.Fprintf(&out, "\n")
+	}
+
+	b, err := yaml.Marshal(renderMachineConfig(r.MachineConfig))
+	if err != nil {
+		log.Fatal(err)
+	}
+	out.Write(b)
+	return out.String()
+}
@@ -0,0 +1,77 @@
+package converter
+
+import (
+	"log"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// splitRoles Returns the roles of a comma separated list
+func splitRoles(roles string) []string {
+	var list []string
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.ToLower(strings.TrimSpace(role)); role != "" {
+			list = append(list, role)
+		}
+	}
+	return list
+}
+
+// checkRoles Normalize and verify the roles a MachineConfig is generated for
+func checkRoles(rawdata *Parameters) {
+	if rawdata.Into != "" {
+		log.Fatalf("--roles can't be used with --into, a single MachineConfig is updated")
+	}
+	roles := splitRoles(rawdata.Roles)
+	if len(roles) == 0 {
+		log.Fatalf("Invalid roles %s, expected role[,role...]", rawdata.Roles)
+	}
+	for i, role := range roles {
+		if errs := validation.IsValidLabelValue(role); len(errs) > 0 {
+			log.Fatalf("Invalid role %s: %s", role, strings.Join(errs, ", "))
+		}
+		if stringInList(role, roles[:i]) {
+			log.Fatalf("Role %s is duplicated", role)
+		}
+	}
+	if rawdata.Labels != "" && labelsToMap(strings.ToLower(rawdata.Labels))[roleLabel] != "" {
+		log.Printf("the %s label is set by --roles, ignoring the one in the labels", roleLabel)
+	}
+	rawdata.Roles = strings.Join(roles, ",")
+}
+
+// roleName Returns the name of the MachineConfig of a role, replacing the role in the name (99-worker-foo) or adding it
+func roleName(name string, role string, roles []string) string {
+	parts := strings.Split(name, "-")
+	for i, part := range parts {
+		if stringInList(part, roles) {
+			parts[i] = role
+			return strings.Join(parts, "-")
+		}
+	}
+	return name + "-" + role
+}
+
+// NewMachineConfigs Creates a MachineConfig per role, or the single one described by the parameters if there are no roles
+func NewMachineConfigs(data Parameters) []MachineConfigObject {
+	roles := splitRoles(data.Roles)
+	if len(roles) == 0 {
+		return []MachineConfigObject{NewMachineConfig(data)}
+	}
+
+	var mcs []MachineConfigObject
+	for _, role := range roles {
+		labelmap := make(map[string]string)
+		if data.Labels != "" {
+			labelmap = labelsToMap(data.Labels)
+		}
+		labelmap[roleLabel] = role
+
+		roledata := data
+		roledata.Labels = labelsString(labelmap)
+		roledata.Name = roleName(data.Name, role, roles)
+		mcs = append(mcs, NewMachineConfig(roledata))
+	}
+	return mcs
+}
@@ -0,0 +1,176 @@
+package converter
+
+import (
+	b64 "encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+)
+
+// The machine-config-operator only manages the keys of the core user
+var defaultSSHUser = "core"
+
+// Key types sshd accepts in authorized_keys (man 8 sshd)
+var sshKeyTypes = []string{
+	"ssh-rsa", "ssh-dss", "ssh-ed25519",
+	"ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521",
+	"sk-ecdsa-sha2-nistp256@openssh.com", "sk-ssh-ed25519@openssh.com",
+	"ssh-rsa-cert-v01@openssh.com", "ssh-dss-cert-v01@openssh.com", "ssh-ed25519-cert-v01@openssh.com",
+	"ecdsa-sha2-nistp256-cert-v01@openssh.com", "ecdsa-sha2-nistp384-cert-v01@openssh.com",
+	"ecdsa-sha2-nistp521-cert-v01@openssh.com",
+}
+
+// authorized_keys options, the ones requiring a value end with =
+var sshKeyOptions = []string{
+	"agent-forwarding", "cert-authority", "command=", "environment=", "expiry-time=", "from=",
+	"no-agent-forwarding", "no-port-forwarding", "no-pty", "no-user-rc", "no-X11-forwarding",
+	"no-touch-required", "permitlisten=", "permitopen=", "port-forwarding", "principals=", "pty",
+	"restrict", "tunnel=", "user-rc", "verify-required", "X11-forwarding",
+}
+
+// splitSSHKeyOptions Splits the options of a key line, commas and blanks between quotes don't count
+func splitSSHKeyOptions(line string) ([]string, string, error) {
+	var options []string
+	quoted := false
+	start := 0
+	for i, c := range line {
+		switch {
+		case c == '"' && (i == 0 || line[i-1] != '\\'):
+			quoted = !quoted
+		case c == ',' && !quoted:
+			options = append(options, line[start:i])
+			start = i + 1
+		case (c == ' ' || c == '\t') && !quoted:
+			return append(options, line[start:i]), strings.TrimSpace(line[i:]), nil
+		}
+	}
+	if quoted {
+		return nil, "", fmt.Errorf("unbalanced quotes in options")
+	}
+	return nil, "", fmt.Errorf("no key after the options")
+}
+
+// validateSSHKeyOption Verify an option is known and has a value only if it requires one
+func validateSSHKeyOption(option string) error {
+	name := option
+	if i := strings.Index(option, "="); i >= 0 {
+		name = option[:i+1]
+		value := option[i+1:]
+		if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+			return fmt.Errorf("the value of option %s must be quoted", option[:i])
+		}
+	}
+	for _, known := range sshKeyOptions {
+		if strings.EqualFold(known, name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown option %s", option)
+}
+
+// validateSSHKeyBlob Verify the blob is base64 and holds a key of the declared type
+func validateSSHKeyBlob(keytype string, blob string) error {
+	data, err := b64.StdEncoding.DecodeString(blob)
+	if err != nil {
+		return fmt.Errorf("invalid base64 key: %s", err)
+	}
+	if len(data) < 4 {
+		return fmt.Errorf("key is too short")
+	}
+	length := binary.BigEndian.Uint32(data[:4])
+	if uint64(len(data)) < 4+uint64(length) {
+		return fmt.Errorf("key is too short")
+	}
+	if string(data[4:4+length]) != keytype {
+		return fmt.Errorf("key type is %s but the key is %s", keytype, string(data[4:4+length]))
+	}
+	return nil
+}
+
+// parseSSHKey Validates an authorized_keys line: [options] type base64-key [comment]
+func parseSSHKey(line string) (string, error) {
+	fields := strings.Fields(line)
+	if !stringInList(fields[0], sshKeyTypes) {
+		options, rest, err := splitSSHKeyOptions(line)
+		if err != nil {
+			return "", err
+		}
+		for _, option := range options {
+			if err := validateSSHKeyOption(option); err != nil {
+				return "", err
+			}
+		}
+		fields = strings.Fields(rest)
+		if !stringInList(fields[0], sshKeyTypes) {
+			return "", fmt.Errorf("unknown key type %s", fields[0])
+		}
+	}
+	if len(fields) < 2 {
+		return "", fmt.Errorf("key is missing")
+	}
+	if err := validateSSHKeyBlob(fields[0], fields[1]); err != nil {
+		return "", err
+	}
+	return line, nil
+}
+
+// readSSHKeys Returns the valid keys of an authorized_keys file, blank lines and comments are skipped
+func readSSHKeys(file string) []string {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var keys []string
+	for n, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := parseSSHKey(line)
+		if err != nil {
+			log.Fatalf("Invalid key in %s line %d: %s", file, n+1, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		log.Fatalf("%s doesn't contain any key", file)
+	}
+	return keys
+}
+
+// checkSSHKeys Add the keys of the authorized_keys files to the ssh user
+func checkSSHKeys(rawdata *Parameters) {
+	if len(rawdata.SSHKeysFiles) == 0 {
+		return
+	}
+	if rawdata.SSHUser == "" {
+		rawdata.SSHUser = defaultSSHUser
+	}
+	if rawdata.SSHUser != defaultSSHUser {
+		log.Printf("the machine-config-operator only supports ssh keys for the '%s' user", defaultSSHUser)
+	}
+
+	i := findPasswdUser(rawdata.PasswdUsers, rawdata.SSHUser)
+	if i < 0 {
+		rawdata.PasswdUsers = append(rawdata.PasswdUsers, igntypes.PasswdUser{Name: rawdata.SSHUser})
+		i = len(rawdata.PasswdUsers) - 1
+	}
+	seen := make(map[string]bool)
+	for _, k := range rawdata.PasswdUsers[i].SSHAuthorizedKeys {
+		seen[string(k)] = true
+	}
+	for _, file := range rawdata.SSHKeysFiles {
+		for _, key := range readSSHKeys(file) {
+			if seen[key] {
+				log.Printf("skipping duplicated key in %s: %s", file, key)
+				continue
+			}
+			seen[key] = true
+			rawdata.PasswdUsers[i].SSHAuthorizedKeys = append(rawdata.PasswdUsers[i].SSHAuthorizedKeys, igntypes.SSHAuthorizedKey(key))
+		}
+	}
+}
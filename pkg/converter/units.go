@@ -0,0 +1,144 @@
+package converter
+
+import (
+	"io/ioutil"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/go-systemd/unit"
+
+	"github.com/coreos/ignition/config/shared/validations"
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+)
+
+// Sections systemd understands for every unit type, besides [Unit] and [Install]
+var unitSections = map[string]string{
+	".service":   "Service",
+	".socket":    "Socket",
+	".mount":     "Mount",
+	".automount": "Automount",
+	".swap":      "Swap",
+	".timer":     "Timer",
+	".path":      "Path",
+	".slice":     "Slice",
+	".scope":     "Scope",
+}
+
+// findUnit Returns the index of the named unit, creating it if needed
+func findUnit(rawdata *Parameters, name string) int {
+	for i := range rawdata.Units {
+		if rawdata.Units[i].Name == name {
+			return i
+		}
+	}
+	rawdata.Units = append(rawdata.Units, igntypes.Unit{Name: name})
+	return len(rawdata.Units) - 1
+}
+
+// readUnitFile Returns the content of a local unit or dropin file
+func readUnitFile(local string) string {
+	f, err := ioutil.ReadFile(local)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(f)
+}
+
+// checkUnits Add the units and dropins provided as flags and validate all of them
+func checkUnits(rawdata *Parameters) {
+	for _, local := range rawdata.UnitFiles {
+		i := findUnit(rawdata, filepath.Base(local))
+		rawdata.Units[i].Contents = readUnitFile(local)
+	}
+
+	// unit:local, the dropin name is the local file name
+	for _, spec := range rawdata.Dropins {
+		parts := strings.SplitN(spec, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Fatalf("Invalid dropin %s, expected unit:/local/path/to/dropin.conf", spec)
+		}
+		i := findUnit(rawdata, parts[0])
+		rawdata.Units[i].Dropins = append(rawdata.Units[i].Dropins, igntypes.SystemdDropin{
+			Name:     filepath.Base(parts[1]),
+			Contents: readUnitFile(parts[1]),
+		})
+	}
+
+	enabled := true
+	disabled := false
+	for _, name := range rawdata.Enable {
+		rawdata.Units[findUnit(rawdata, name)].Enabled = &enabled
+	}
+	for _, name := range rawdata.Disable {
+		rawdata.Units[findUnit(rawdata, name)].Enabled = &disabled
+	}
+	for _, name := range rawdata.Mask {
+		rawdata.Units[findUnit(rawdata, name)].Mask = true
+	}
+
+	for _, u := range rawdata.Units {
+		validateUnit(u)
+	}
+}
+
+// validateUnit Parse the unit and its dropins so a broken unit fails here instead of on the node
+func validateUnit(u igntypes.Unit) {
+	for _, entry := range u.ValidateName().Entries {
+		log.Fatalf("Unit %s: %s", u.Name, entry.Message)
+	}
+	if u.Mask && u.Enabled != nil && *u.Enabled {
+		log.Fatalf("Unit %s can't be both enabled and masked", u.Name)
+	}
+
+	opts := parseUnitContents(u.Name, u.Name, u.Contents)
+	isEnabled := u.Enabled != nil && *u.Enabled
+	for _, entry := range validations.ValidateInstallSection(u.Name, isEnabled, u.Contents == "", opts).Entries {
+		log.Printf("unit %s: %s", u.Name, entry.Message)
+	}
+
+	seen := make(map[string]bool)
+	for _, d := range u.Dropins {
+		if path.Ext(d.Name) != ".conf" {
+			log.Fatalf("Dropin %s of unit %s must have the .conf extension", d.Name, u.Name)
+		}
+		if seen[d.Name] {
+			log.Fatalf("Dropin %s of unit %s is duplicated", d.Name, u.Name)
+		}
+		seen[d.Name] = true
+		parseUnitContents(u.Name, d.Name, d.Contents)
+	}
+}
+
+// parseUnitContents Deserialize the unit contents, rejecting sections systemd doesn't know for that unit type
+func parseUnitContents(unitname string, name string, contents string) []*unit.UnitOption {
+	if contents == "" {
+		return nil
+	}
+	opts, err := unit.Deserialize(strings.NewReader(contents))
+	if err != nil {
+		log.Fatalf("%s has invalid contents: %s", name, err)
+	}
+	// The deserializer silently drops anything before the first section
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if !strings.HasPrefix(line, "[") {
+			log.Fatalf("%s has content outside of any section: %s", name, line)
+		}
+		break
+	}
+	for _, opt := range opts {
+		switch {
+		case opt.Section == "Unit", opt.Section == "Install":
+		case opt.Section == unitSections[path.Ext(unitname)]:
+		case strings.HasPrefix(opt.Section, "X-"):
+		default:
+			log.Fatalf("%s has an unknown section [%s]", name, opt.Section)
+		}
+	}
+	return opts
+}
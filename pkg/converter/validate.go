@@ -0,0 +1,148 @@
+package converter
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+
+	ignv2_2 "github.com/coreos/ignition/config/v2_2"
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+// configPaths Returns the JSON path of every line of an indented JSON document (index = line number)
+func configPaths(indented []byte) []string {
+	type level struct {
+		key   string
+		array bool
+		index int
+	}
+	var stack []level
+	paths := []string{""}
+	for _, line := range strings.Split(string(indented), "\n") {
+		t := strings.TrimSuffix(strings.TrimSpace(line), ",")
+
+		// "key": value, array items have no key
+		key := ""
+		if strings.HasPrefix(t, "\"") {
+			if i := strings.Index(t, "\": "); i > 0 {
+				key = t[1:i]
+				t = t[i+3:]
+			}
+		}
+		if len(stack) > 0 && stack[len(stack)-1].array && !strings.HasPrefix(t, "]") {
+			key = strconv.Itoa(stack[len(stack)-1].index)
+		}
+
+		var keys []string
+		for _, l := range stack {
+			if l.key != "" {
+				keys = append(keys, l.key)
+			}
+		}
+		if key != "" {
+			keys = append(keys, key)
+		}
+		paths = append(paths, strings.Join(keys, "."))
+
+		switch {
+		case strings.HasSuffix(t, "{") || strings.HasSuffix(t, "["):
+			stack = append(stack, level{key: key, array: strings.HasSuffix(t, "[")})
+		case strings.HasPrefix(t, "}") || strings.HasPrefix(t, "]"):
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 && stack[len(stack)-1].array {
+				stack[len(stack)-1].index++
+			}
+		case len(stack) > 0 && stack[len(stack)-1].array:
+			stack[len(stack)-1].index++
+		}
+	}
+	return paths
+}
+
+// nodeName Returns the remote path or name of the node a JSON path points to
+func nodeName(cfg igntypes.Config, jsonpath string) string {
+	parts := strings.Split(jsonpath, ".")
+	if len(parts) < 3 {
+		return ""
+	}
+	i, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return ""
+	}
+	switch {
+	case parts[0] == "storage" && parts[1] == "files" && i < len(cfg.Storage.Files):
+		return cfg.Storage.Files[i].Path
+	case parts[0] == "storage" && parts[1] == "directories" && i < len(cfg.Storage.Directories):
+		return cfg.Storage.Directories[i].Path
+	case parts[0] == "storage" && parts[1] == "links" && i < len(cfg.Storage.Links):
+		return cfg.Storage.Links[i].Path
+	case parts[0] == "systemd" && parts[1] == "units" && i < len(cfg.Systemd.Units):
+		return cfg.Systemd.Units[i].Name
+	case parts[0] == "passwd" && parts[1] == "users" && i < len(cfg.Passwd.Users):
+		return cfg.Passwd.Users[i].Name
+	case parts[0] == "passwd" && parts[1] == "groups" && i < len(cfg.Passwd.Groups):
+		return cfg.Passwd.Groups[i].Name
+	}
+	return ""
+}
+
+// ValidateConfig Runs the config through the Ignition 2.2 parser and validator
+func ValidateConfig(cfg igntypes.Config) report.Report {
+	// Unset modes are 0644/0755 in spec 3, 2.2 would warn about them
+	if strings.HasPrefix(cfg.Ignition.Version, "3.") {
+		cfg.Storage.Files = append([]igntypes.File(nil), cfg.Storage.Files...)
+		for i := range cfg.Storage.Files {
+			if cfg.Storage.Files[i].Mode == nil {
+				mode := defaultFileMode
+				cfg.Storage.Files[i].Mode = &mode
+			}
+		}
+		cfg.Storage.Directories = append([]igntypes.Directory(nil), cfg.Storage.Directories...)
+		for i := range cfg.Storage.Directories {
+			if cfg.Storage.Directories[i].Mode == nil {
+				mode := defaultDirectoryMode
+				cfg.Storage.Directories[i].Mode = &mode
+			}
+		}
+	}
+	// The content is always built as 2.2, other versions are translated when printed
+	cfg.Ignition.Version = defaultIgnitionVersion
+	raw, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, rpt, err := ignv2_2.Parse(raw)
+	if err != nil && !rpt.IsFatal() {
+		log.Fatalf("The generated config can't be parsed: %s", err)
+	}
+
+	// Replace line numbers with the path of the offending field
+	paths := configPaths(raw)
+	for i, entry := range rpt.Entries {
+		location := "spec.config"
+		if entry.Line > 0 && entry.Line < len(paths) && paths[entry.Line] != "" {
+			location += "." + paths[entry.Line]
+			if name := nodeName(cfg, paths[entry.Line]); name != "" {
+				location += " (" + name + ")"
+			}
+		}
+		rpt.Entries[i].Message = location + ": " + entry.Message
+		rpt.Entries[i].Line = 0
+		rpt.Entries[i].Column = 0
+		rpt.Entries[i].Highlight = ""
+	}
+	return rpt
+}
+
+// ValidateMachineConfig Print the validation report of a MachineConfig, failing if the config is invalid
+func ValidateMachineConfig(mc MachineConfigObject) {
+	rpt := ValidateConfig(mc.Spec.Config)
+	for _, entry := range rpt.Entries {
+		log.Printf("%s", entry)
+	}
+	if rpt.IsFatal() {
+		log.Fatalf("MachineConfig %s is not valid", mc.Name)
+	}
+}
@@ -0,0 +1,50 @@
+package converter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	igntypes "github.com/coreos/ignition/config/v2_2/types"
+)
+
+func TestConfigPaths(t *testing.T) {
+	indented := `{
+  "a": {
+    "b": [
+      {
+        "c": 1
+      },
+      2
+    ],
+    "d": "x"
+  }
+}`
+	want := []string{"", "", "a", "a.b", "a.b.0", "a.b.0.c", "a.b.0", "a.b.1", "a.b", "a.d", "a", ""}
+	if got := configPaths([]byte(indented)); !reflect.DeepEqual(got, want) {
+		t.Errorf("configPaths() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateConfigLocation(t *testing.T) {
+	mode := 0644
+	cfg := igntypes.Config{Ignition: igntypes.Ignition{Version: defaultIgnitionVersion}}
+	cfg.Storage.Files = []igntypes.File{
+		{Node: igntypes.Node{Filesystem: "root", Path: "/etc/good"}, FileEmbedded1: igntypes.FileEmbedded1{Mode: &mode}},
+		{Node: igntypes.Node{Filesystem: "root", Path: "/etc/unset"}},
+	}
+
+	rpt := ValidateConfig(cfg)
+	if len(rpt.Entries) != 1 {
+		t.Fatalf("ValidateConfig() = %v, want a single entry", rpt.Entries)
+	}
+	if want := "spec.config.storage.files.1 (/etc/unset): "; !strings.HasPrefix(rpt.Entries[0].Message, want) {
+		t.Errorf("ValidateConfig() message = %q, want it to start with %q", rpt.Entries[0].Message, want)
+	}
+
+	// Unset modes have a default in spec 3
+	cfg.Ignition.Version = "3.2.0"
+	if rpt := ValidateConfig(cfg); len(rpt.Entries) != 0 {
+		t.Errorf("ValidateConfig() = %v for spec 3, want no entry", rpt.Entries)
+	}
+}
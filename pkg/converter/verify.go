@@ -0,0 +1,101 @@
+package converter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"strings"
+
+	"github.com/vincent-petithory/dataurl"
+)
+
+// Hash functions ignition understands (sha256 is only available in spec 3)
+var hashFunctions = map[string]func() hash.Hash{
+	"sha512": sha512.New,
+	"sha256": sha256.New,
+}
+var defaultHashFunction = "sha512"
+
+// HashResult Result of verifying the hash of a single file
+type HashResult struct {
+	Path     string
+	Expected string
+	Actual   string
+	Err      error
+	Skipped  bool
+}
+
+// contentHash Returns the function-sum hash of the content
+func contentHash(function string, content []byte) (string, error) {
+	newHash, ok := hashFunctions[function]
+	if !ok {
+		return "", fmt.Errorf("unsupported hash function %s", function)
+	}
+	h := newHash()
+	h.Write(content)
+	return function + "-" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// decodeSource Returns the decompressed payload of a data URL
+func decodeSource(source string, compression string) ([]byte, error) {
+	if !strings.HasPrefix(source, "data:") {
+		return nil, fmt.Errorf("only data URLs can be decoded, got %s", source)
+	}
+	du, err := dataurl.DecodeString(source)
+	if err != nil {
+		return nil, err
+	}
+	switch compression {
+	case "":
+		return du.Data, nil
+	case compressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(du.Data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", compression)
+	}
+}
+
+// VerifyHashes Decodes every file payload of the MachineConfig and compares it with its hash
+func VerifyHashes(mc MachineConfigObject) []HashResult {
+	var results []HashResult
+	for _, f := range mc.Spec.Config.Storage.Files {
+		result := HashResult{Path: f.Path}
+		if f.Contents.Verification.Hash == nil {
+			result.Err = fmt.Errorf("no hash recorded")
+			results = append(results, result)
+			continue
+		}
+		result.Expected = *f.Contents.Verification.Hash
+
+		// Remote sources are verified by the node when downloading them
+		if !strings.HasPrefix(f.Contents.Source, "data:") {
+			result.Skipped = true
+			results = append(results, result)
+			continue
+		}
+
+		content, err := decodeSource(f.Contents.Source, f.Contents.Compression)
+		if err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+		function := strings.SplitN(result.Expected, "-", 2)[0]
+		result.Actual, result.Err = contentHash(function, content)
+		if result.Err == nil && result.Actual != result.Expected {
+			result.Err = fmt.Errorf("hash mismatch")
+		}
+		results = append(results, result)
+	}
+	return results
+}